@@ -1 +1,125 @@
 package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// BindCommand registers a flag for every config key on the flags of the
+// command. Use WithFlags(cmd.Flags()) to load the config with the flags.
+func BindCommand(cmd *cobra.Command, structPtr interface{}) error {
+	return RegisterFlags(cmd.Flags(), structPtr)
+}
+
+// RegisterFlags registers a flag for every config key on the flag set. The
+// flag name is the key with underscores replaced by dashes (e.g., the key
+// 'app.log_level' becomes '--app.log-level'). The default value is the value
+// from the `default` tag and `doc` is used as the usage. Keys of unsupported
+// types (e.g., maps) are skipped.
+func RegisterFlags(fs *pflag.FlagSet, structPtr interface{}) error {
+	defs, err := extractConfigDefs(structPtr, true)
+	if err != nil {
+		return err
+	}
+
+	for _, def := range defs {
+		name := flagName(def.Key)
+		if fs.Lookup(name) != nil {
+			return fmt.Errorf("flag '%s' is already defined", name)
+		}
+		registerFlag(fs, name, def.Doc, def.Default)
+	}
+	return nil
+}
+
+// WithFlags binds the flags registered using RegisterFlags (or BindCommand)
+// to the config keys. Flags that are explicitly set take precedence over the
+// env, the config file and the defaults.
+func WithFlags(fs *pflag.FlagSet) Option {
+	return func(l *viperLoader) error {
+		if fs == nil {
+			return fmt.Errorf("flag set must not be nil")
+		}
+		l.flags = fs
+		return nil
+	}
+}
+
+func (l *viperLoader) bindFlags(keys []configDef) error {
+	if l.flags == nil {
+		return nil
+	}
+
+	for _, cfg := range keys {
+		f := l.flags.Lookup(flagName(cfg.Key))
+		if f == nil {
+			continue
+		}
+
+		if err := l.viper.BindPFlag(cfg.Key, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerFlag(fs *pflag.FlagSet, name, usage string, def interface{}) {
+	switch v := def.(type) {
+	case time.Duration:
+		fs.Duration(name, v, usage)
+
+	case string:
+		fs.String(name, v, usage)
+
+	case bool:
+		fs.Bool(name, v, usage)
+
+	case int:
+		fs.Int(name, v, usage)
+
+	case int64:
+		fs.Int64(name, v, usage)
+
+	case uint:
+		fs.Uint(name, v, usage)
+
+	case float64:
+		fs.Float64(name, v, usage)
+
+	case []string:
+		fs.StringSlice(name, v, usage)
+
+	case []int:
+		fs.IntSlice(name, v, usage)
+
+	default:
+		// named types and other numeric types are registered using their
+		// underlying or widest form.
+		rv := reflect.ValueOf(def)
+		switch rv.Kind() {
+		case reflect.String:
+			fs.String(name, rv.String(), usage)
+
+		case reflect.Bool:
+			fs.Bool(name, rv.Bool(), usage)
+
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fs.Int64(name, rv.Int(), usage)
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fs.Uint64(name, rv.Uint(), usage)
+
+		case reflect.Float32:
+			fs.Float64(name, rv.Float(), usage)
+		}
+	}
+}
+
+func flagName(key string) string {
+	return strings.Replace(key, "_", "-", -1)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flagConfig struct {
+	Addr string `default:":8080" doc:"Address to listen on"`
+	Log  struct {
+		Level  string `default:"info"`
+		Format string `default:"text"`
+	}
+	Timeout time.Duration `default:"5s"`
+	Workers int           `default:"4"`
+}
+
+func TestBindCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "app.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("addr: ':9090'\nlog:\n  level: warn\n  format: json\n"), 0600))
+
+	os.Setenv("TEST_LOG_LEVEL", "error")
+	os.Setenv("TEST_LOG_FORMAT", "logfmt")
+	os.Setenv("TEST_WORKERS", "8")
+	defer os.Unsetenv("TEST_LOG_LEVEL")
+	defer os.Unsetenv("TEST_LOG_FORMAT")
+	defer os.Unsetenv("TEST_WORKERS")
+
+	cmd := &cobra.Command{Use: "app", Run: func(*cobra.Command, []string) {}}
+	require.NoError(t, BindCommand(cmd, &flagConfig{}))
+
+	f := cmd.Flags().Lookup("addr")
+	require.NotNil(t, f)
+	assert.Equal(t, "Address to listen on", f.Usage)
+	assert.Equal(t, ":8080", f.DefValue)
+
+	cmd.SetArgs([]string{"--log.level", "debug", "--timeout", "1m"})
+	require.NoError(t, cmd.Execute())
+
+	var cfg flagConfig
+	require.NoError(t, Load(&cfg, WithFile(file), WithEnv("test"), WithFlags(cmd.Flags())))
+	assert.Equal(t, ":9090", cfg.Addr)
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, "logfmt", cfg.Log.Format)
+	assert.Equal(t, time.Minute, cfg.Timeout)
+	assert.Equal(t, 8, cfg.Workers)
+}
@@ -4,26 +4,41 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/mcuadros/go-defaults"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-// Load loads configurations into the given structPtr.
+// Load loads configurations into the given structPtr. References to secrets
+// in the loaded values are resolved (see WithSecretResolver) and the values
+// are validated as per the `validate` tags (see ValidationError) and
+// Validator.
 func Load(structPtr interface{}, opts ...Option) error {
+	l, err := newLoader(structPtr, opts...)
+	if err != nil {
+		return err
+	}
+
+	return l.load()
+}
+
+func newLoader(structPtr interface{}, opts ...Option) (*viperLoader, error) {
 	l := &viperLoader{
 		viper:       viper.New(),
 		intoPtr:     structPtr,
 		useDefaults: true,
+		resolvers:   defaultResolvers(),
 	}
 
 	for _, opt := range opts {
 		if err := opt(l); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return l.load()
+	return l, nil
 }
 
 type viperLoader struct {
@@ -35,6 +50,12 @@ type viperLoader struct {
 	useEnv      bool
 	envPrefix   string
 	useDefaults bool
+	flags       *pflag.FlagSet
+	resolvers   map[string]SecretResolver
+	useSecrets  bool
+
+	pollInterval time.Duration
+	onReloadErr  func(err error)
 }
 
 func (l *viperLoader) load() error {
@@ -61,6 +82,10 @@ func (l *viperLoader) load() error {
 		}
 	}
 
+	if err := l.bindFlags(keys); err != nil {
+		return err
+	}
+
 	if l.confFile != "" {
 		v.SetConfigFile(l.confFile)
 		if err := v.ReadInConfig(); err != nil {
@@ -75,13 +100,24 @@ func (l *viperLoader) load() error {
 		_ = v.ReadInConfig()
 	}
 
-	return v.Unmarshal(l.intoPtr)
+	if err := v.Unmarshal(l.intoPtr); err != nil {
+		return err
+	}
+
+	if l.useSecrets {
+		if err := l.resolveSecrets(deref(reflect.ValueOf(l.intoPtr)), ""); err != nil {
+			return err
+		}
+	}
+	return validate(l.intoPtr)
 }
 
 type configDef struct {
-	Key     string      `json:"key"`
-	Doc     string      `json:"doc"`
-	Default interface{} `json:"default"`
+	Key      string      `json:"key"`
+	Doc      string      `json:"doc"`
+	Default  interface{} `json:"default"`
+	Validate string      `json:"validate,omitempty"`
+	Secret   bool        `json:"secret,omitempty"`
 }
 
 func extractConfigDefs(structPtr interface{}, useDefaults bool) ([]configDef, error) {
@@ -119,9 +155,11 @@ func readRecursive(rv reflect.Value, rootKey string) ([]configDef, error) {
 			acc = append(acc, nestedConfigs...)
 		} else {
 			acc = append(acc, configDef{
-				Key:     key,
-				Doc:     ft.Tag.Get("doc"),
-				Default: fv.Interface(),
+				Key:      key,
+				Doc:      ft.Tag.Get("doc"),
+				Default:  fv.Interface(),
+				Validate: ft.Tag.Get("validate"),
+				Secret:   ft.Tag.Get("secret") == "true",
 			})
 		}
 	}
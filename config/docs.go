@@ -0,0 +1,260 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyDoc describes a single config key.
+type KeyDoc struct {
+	Key      string      `json:"key"`
+	Doc      string      `json:"doc"`
+	Default  interface{} `json:"default"`
+	Env      string      `json:"env,omitempty"`
+	Validate string      `json:"validate,omitempty"`
+}
+
+// Describe returns the documentation of all the keys in the struct. Env is
+// set only if WithEnv is passed in opts. Defaults from the `default` tags are
+// applied to the structPtr. Defaults of secret keys are not included.
+func Describe(structPtr interface{}, opts ...Option) ([]KeyDoc, error) {
+	l, err := newLoader(structPtr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	defs, err := extractConfigDefs(structPtr, l.useDefaults)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]KeyDoc, len(defs))
+	for i, def := range defs {
+		docs[i] = KeyDoc{
+			Key:      def.Key,
+			Doc:      def.Doc,
+			Default:  def.Default,
+			Validate: def.Validate,
+		}
+		if def.Secret {
+			docs[i].Default = ""
+		}
+		if l.useEnv {
+			docs[i].Env = envName(l.envPrefix, def.Key)
+		}
+	}
+	return docs, nil
+}
+
+// EnvVars returns the names of the environment variables that can be used to
+// set the config keys. The prefix set using WithEnv in opts (if any) is
+// applied to the names.
+func EnvVars(structPtr interface{}, opts ...Option) ([]string, error) {
+	docs, err := Describe(structPtr, append(append([]Option(nil), opts...), WithEnv())...)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(docs))
+	for i, d := range docs {
+		names[i] = d.Env
+	}
+	return names, nil
+}
+
+// WriteMarkdown writes a Markdown table documenting every config key.
+func WriteMarkdown(w io.Writer, structPtr interface{}, opts ...Option) error {
+	docs, err := Describe(structPtr, opts...)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("| Key | Env | Default | Description |\n")
+	sb.WriteString("|-----|-----|---------|-------------|\n")
+	for _, d := range docs {
+		env := ""
+		if d.Env != "" {
+			env = "`" + d.Env + "`"
+		}
+		sb.WriteString(fmt.Sprintf("| `%s` | %s | `%s` | %s |\n",
+			d.Key, env, formatValue(d.Default), mdEscape(d.Doc)))
+	}
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteSampleYAML writes a sample YAML config file with the default values
+// and the docs as comments.
+func WriteSampleYAML(w io.Writer, structPtr interface{}, opts ...Option) error {
+	docs, err := Describe(structPtr, opts...)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	var prev []string
+	for _, d := range docs {
+		parts := strings.Split(d.Key, ".")
+		section, name := parts[:len(parts)-1], parts[len(parts)-1]
+
+		common := commonPrefix(prev, section)
+		for i := common; i < len(section); i++ {
+			sb.WriteString(fmt.Sprintf("%s%s:\n", indent(i), section[i]))
+		}
+		prev = section
+
+		writeComment(&sb, indent(len(section)), d.Doc)
+		sb.WriteString(fmt.Sprintf("%s%s: %s\n", indent(len(section)), name, formatValue(d.Default)))
+	}
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteSampleTOML writes a sample TOML config file with the default values
+// and the docs as comments.
+func WriteSampleTOML(w io.Writer, structPtr interface{}, opts ...Option) error {
+	docs, err := Describe(structPtr, opts...)
+	if err != nil {
+		return err
+	}
+
+	// keys of a table must be listed before any sub-tables.
+	sort.SliceStable(docs, func(i, j int) bool {
+		return tableOf(docs[i].Key) < tableOf(docs[j].Key)
+	})
+
+	var sb strings.Builder
+	section := ""
+	for _, d := range docs {
+		table := tableOf(d.Key)
+		name := strings.TrimPrefix(d.Key[len(table):], ".")
+
+		if table != section {
+			sb.WriteString(fmt.Sprintf("\n[%s]\n", table))
+			section = table
+		}
+
+		writeComment(&sb, "", d.Doc)
+		sb.WriteString(fmt.Sprintf("%s = %s\n", name, formatValue(d.Default)))
+	}
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// RunDocTool implements a command line tool for generating documentation of
+// the config struct. Applications can expose it as a sub-command:
+//
+//	config.RunDocTool(os.Args[2:], os.Stdout, &Config{}, config.WithEnv("APP"))
+//
+// The '-format' flag selects the output: markdown (default), yaml, toml or
+// env.
+func RunDocTool(args []string, out io.Writer, structPtr interface{}, opts ...Option) error {
+	fs := flag.NewFlagSet("config-doc", flag.ContinueOnError)
+	fs.SetOutput(out)
+	format := fs.String("format", "markdown", "output format (markdown, yaml, toml or env)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(*format) {
+	case "markdown", "md":
+		return WriteMarkdown(out, structPtr, opts...)
+
+	case "yaml", "yml":
+		return WriteSampleYAML(out, structPtr, opts...)
+
+	case "toml":
+		return WriteSampleTOML(out, structPtr, opts...)
+
+	case "env":
+		names, err := EnvVars(structPtr, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, strings.Join(names, "\n"))
+		return err
+
+	default:
+		return fmt.Errorf("unknown format '%s'", *format)
+	}
+}
+
+// envName returns the env variable name for the key as resolved by viper
+// (e.g., 'app.log-level' with prefix 'svc' to 'SVC_APP_LOG_LEVEL').
+func envName(prefix, key string) string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(key)
+	if prefix != "" {
+		name = prefix + "_" + name
+	}
+	return strings.ToUpper(name)
+}
+
+// formatValue formats the value as a YAML/TOML compatible literal.
+func formatValue(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return `""`
+	}
+
+	if d, ok := v.(time.Duration); ok {
+		return strconv.Quote(d.String())
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return strconv.Quote(rv.String())
+
+	case reflect.Slice, reflect.Array:
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = formatValue(rv.Index(i).Interface())
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+
+	case reflect.Map:
+		return "{}"
+
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeComment(sb *strings.Builder, prefix, doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		sb.WriteString(fmt.Sprintf("%s# %s\n", prefix, line))
+	}
+}
+
+func tableOf(key string) string {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+func commonPrefix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func indent(level int) string { return strings.Repeat("  ", level) }
+
+func mdEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type docConfig struct {
+	Addr string `default:":8080" doc:"Address to listen on"`
+	Log  struct {
+		Level string `default:"info" doc:"Log level"`
+	}
+	Timeout time.Duration `default:"5s"`
+}
+
+func TestEnvVars(t *testing.T) {
+	names, err := EnvVars(&docConfig{}, WithEnv("svc"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SVC_ADDR", "SVC_LOG_LEVEL", "SVC_TIMEOUT"}, names)
+}
+
+func TestWriteSampleYAML(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSampleYAML(&buf, &docConfig{}))
+	assert.Equal(t, `# Address to listen on
+addr: ":8080"
+log:
+  # Log level
+  level: "info"
+timeout: "5s"
+`, buf.String())
+}
+
+func TestWriteSampleTOML(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSampleTOML(&buf, &docConfig{}))
+	assert.Equal(t, `# Address to listen on
+addr = ":8080"
+timeout = "5s"
+
+[log]
+# Log level
+level = "info"
+`, buf.String())
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var escaped struct {
+		Mode string `default:"a" doc:"Either a|b\nor c"`
+	}
+
+	table := []struct {
+		title     string
+		structPtr interface{}
+		opts      []Option
+		want      string
+	}{
+		{
+			title:     "WithoutEnv",
+			structPtr: &docConfig{},
+			want: "| Key | Env | Default | Description |\n" +
+				"|-----|-----|---------|-------------|\n" +
+				"| `addr` |  | `\":8080\"` | Address to listen on |\n" +
+				"| `log.level` |  | `\"info\"` | Log level |\n" +
+				"| `timeout` |  | `\"5s\"` |  |\n",
+		},
+		{
+			title:     "WithEnv",
+			structPtr: &docConfig{},
+			opts:      []Option{WithEnv("svc")},
+			want: "| Key | Env | Default | Description |\n" +
+				"|-----|-----|---------|-------------|\n" +
+				"| `addr` | `SVC_ADDR` | `\":8080\"` | Address to listen on |\n" +
+				"| `log.level` | `SVC_LOG_LEVEL` | `\"info\"` | Log level |\n" +
+				"| `timeout` | `SVC_TIMEOUT` | `\"5s\"` |  |\n",
+		},
+		{
+			title:     "Escaping",
+			structPtr: &escaped,
+			want: "| Key | Env | Default | Description |\n" +
+				"|-----|-----|---------|-------------|\n" +
+				"| `mode` |  | `\"a\"` | Either a\\|b or c |\n",
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WriteMarkdown(&buf, tt.structPtr, tt.opts...))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestRunDocTool(t *testing.T) {
+	table := []struct {
+		title  string
+		args   []string
+		prefix string
+	}{
+		{title: "Default", args: nil, prefix: "| Key | Env |"},
+		{title: "Markdown", args: []string{"-format", "markdown"}, prefix: "| Key | Env |"},
+		{title: "MD", args: []string{"-format", "MD"}, prefix: "| Key | Env |"},
+		{title: "YAML", args: []string{"-format", "yaml"}, prefix: "# Address to listen on\naddr: \":8080\""},
+		{title: "YML", args: []string{"-format", "yml"}, prefix: "# Address to listen on\naddr: \":8080\""},
+		{title: "TOML", args: []string{"-format", "toml"}, prefix: "# Address to listen on\naddr = \":8080\""},
+		{title: "Env", args: []string{"-format", "env"}, prefix: "SVC_ADDR\nSVC_LOG_LEVEL\nSVC_TIMEOUT\n"},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, RunDocTool(tt.args, &buf, &docConfig{}, WithEnv("svc")))
+			assert.True(t, strings.HasPrefix(buf.String(), tt.prefix), buf.String())
+		})
+	}
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := RunDocTool([]string{"-format", "xml"}, &buf, &docConfig{})
+		assert.EqualError(t, err, "unknown format 'xml'")
+		assert.Empty(t, buf.String())
+	})
+}
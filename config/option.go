@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"strings"
+	"time"
 )
 
 type Option func(l *viperLoader) error
@@ -15,3 +17,43 @@ func WithEnv(prefix ...string) Option {
 		return nil
 	}
 }
+
+// WithFile sets the config file to be read. The format is derived from the
+// file extension. Loading fails if the file cannot be read.
+func WithFile(path string) Option {
+	return func(l *viperLoader) error {
+		l.confFile = strings.TrimSpace(path)
+		return nil
+	}
+}
+
+// WithName sets the name (without extension) of the config file to look for
+// in the current directory. Defaults to 'config'.
+func WithName(name string) Option {
+	return func(l *viperLoader) error {
+		l.confName = strings.TrimSpace(name)
+		return nil
+	}
+}
+
+// WithPollInterval sets the interval at which Watch checks the config file
+// for changes. Defaults to 1 second.
+func WithPollInterval(d time.Duration) Option {
+	return func(l *viperLoader) error {
+		if d <= 0 {
+			return fmt.Errorf("poll interval must be positive, not '%s'", d)
+		}
+		l.pollInterval = d
+		return nil
+	}
+}
+
+// WithReloadErrorHandler sets the function to be called by Watch when the
+// changed config file fails to load or validate. The current config is
+// retained in such cases.
+func WithReloadErrorHandler(fn func(err error)) Option {
+	return func(l *viperLoader) error {
+		l.onReloadErr = fn
+		return nil
+	}
+}
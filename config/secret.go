@@ -0,0 +1,227 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces the values of secret keys in Redacted and Sprint.
+const redactedValue = "******"
+
+var refRe = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// SecretResolver resolves references to secrets. The ref is the part after
+// the scheme in '${scheme:ref}' or 'scheme://ref' values.
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretResolverFunc implements SecretResolver using a function.
+type SecretResolverFunc func(ref string) (string, error)
+
+// Resolve calls fn with the ref.
+func (fn SecretResolverFunc) Resolve(ref string) (string, error) { return fn(ref) }
+
+// WithSecrets enables resolving references to secrets in the loaded values
+// using the 'env' and 'file' schemes and the resolvers registered using
+// WithSecretResolver. Without this (or WithSecretResolver), values are used
+// as is.
+//
+// After loading, string values (including elements of string slices) are
+// resolved as follows:
+//
+//	file:///run/secrets/db   entire value is resolved using the scheme
+//	${env:DB_PASS}           resolved using the scheme, fails if not found
+//	${DB_HOST:-localhost}    env variable with a default value
+//	${DB_HOST}               env variable, fails if not set
+func WithSecrets() Option {
+	return func(l *viperLoader) error {
+		l.useSecrets = true
+		return nil
+	}
+}
+
+// WithSecretResolver registers the resolver for the scheme (e.g., 'vault')
+// and enables secret resolution (see WithSecrets). The 'env' and 'file'
+// schemes are registered by default and can be replaced.
+func WithSecretResolver(scheme string, r SecretResolver) Option {
+	return func(l *viperLoader) error {
+		scheme = strings.TrimSpace(scheme)
+		if scheme == "" || r == nil {
+			return fmt.Errorf("secret resolver needs a scheme and a resolver")
+		}
+		l.resolvers[scheme] = r
+		l.useSecrets = true
+		return nil
+	}
+}
+
+// Redacted returns the flattened config with the values of the keys tagged
+// with `secret:"true"` replaced.
+func Redacted(structPtr interface{}) (map[string]interface{}, error) {
+	defs, err := describeValues(structPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		m[def.Key] = def.Default
+	}
+	return m, nil
+}
+
+// Sprint returns the config as 'key=value' lines (in the order of fields)
+// with the values of the keys tagged with `secret:"true"` redacted. Use this
+// instead of printing the struct directly.
+func Sprint(structPtr interface{}) string {
+	defs, err := describeValues(structPtr)
+	if err != nil {
+		return fmt.Sprintf("%%!(config: %v)", err)
+	}
+
+	var sb strings.Builder
+	for _, def := range defs {
+		sb.WriteString(fmt.Sprintf("%s=%v\n", def.Key, def.Default))
+	}
+	return sb.String()
+}
+
+// describeValues returns the current values of the keys with secrets redacted.
+func describeValues(structPtr interface{}) ([]configDef, error) {
+	rv := reflect.ValueOf(structPtr)
+	if err := ensureStructPtr(rv); err != nil {
+		return nil, err
+	}
+
+	defs, err := readRecursive(deref(rv), "")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range defs {
+		if defs[i].Secret {
+			defs[i].Default = redactedValue
+		}
+	}
+	return defs, nil
+}
+
+func defaultResolvers() map[string]SecretResolver {
+	return map[string]SecretResolver{
+		"env":  SecretResolverFunc(resolveEnv),
+		"file": SecretResolverFunc(resolveFile),
+	}
+}
+
+func resolveEnv(name string) (string, error) {
+	v, found := os.LookupEnv(name)
+	if !found {
+		return "", fmt.Errorf("env variable '%s' is not set", name)
+	}
+	return v, nil
+}
+
+func resolveFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecrets resolves the references in all the string values in rv.
+func (l *viperLoader) resolveSecrets(rv reflect.Value, rootKey string) error {
+	rt := rv.Type()
+
+	for i := 0; i < rv.NumField(); i++ {
+		ft := rt.Field(i)
+		fv := deref(rv.Field(i))
+		if !fv.IsValid() || !fv.CanSet() {
+			continue
+		}
+
+		key := toCamelCase(ft.Name)
+		if rootKey != "" {
+			key = fmt.Sprintf("%s.%s", rootKey, key)
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := l.resolveSecrets(fv, key); err != nil {
+				return err
+			}
+
+		case fv.Kind() == reflect.String:
+			if err := l.resolveValue(fv, key); err != nil {
+				return err
+			}
+
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+			for j := 0; j < fv.Len(); j++ {
+				if err := l.resolveValue(fv.Index(j), key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (l *viperLoader) resolveValue(v reflect.Value, key string) error {
+	resolved, err := l.resolve(v.String())
+	if err != nil {
+		return fmt.Errorf("failed to resolve value of '%s': %v", key, err)
+	}
+	v.SetString(resolved)
+	return nil
+}
+
+func (l *viperLoader) resolve(s string) (string, error) {
+	if i := strings.Index(s, "://"); i > 0 {
+		if r, found := l.resolvers[s[:i]]; found {
+			return r.Resolve(s[i+3:])
+		}
+	}
+
+	var resolveErr error
+	resolved := refRe.ReplaceAllStringFunc(s, func(match string) string {
+		ref := match[2 : len(match)-1]
+
+		if i := strings.Index(ref, ":-"); i >= 0 {
+			if v := os.Getenv(ref[:i]); v != "" {
+				return v
+			}
+			return ref[i+2:]
+		}
+
+		i := strings.IndexByte(ref, ':')
+		if i < 0 {
+			v, err := resolveEnv(ref)
+			if err != nil && resolveErr == nil {
+				resolveErr = err
+			}
+			return v
+		}
+
+		r, found := l.resolvers[ref[:i]]
+		if !found {
+			if resolveErr == nil {
+				resolveErr = fmt.Errorf("no secret resolver for scheme '%s'", ref[:i])
+			}
+			return match
+		}
+
+		v, err := r.Resolve(ref[i+1:])
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		return v
+	})
+
+	return resolved, resolveErr
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type secretConfig struct {
+	Database struct {
+		Host     string `default:"${TEST_DB_HOST:-localhost}"`
+		User     string `default:"${env:TEST_DB_USER}"`
+		Password string `secret:"true"`
+	}
+	Token   string `secret:"true" default:"${vault:app/token}"`
+	Brokers []string
+}
+
+func TestLoad_Secrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "db-password")
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("s3cr3t\n"), 0600))
+
+	file := filepath.Join(dir, "app.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("brokers: ['${TEST_BROKER:-kafka:9092}']\n"+
+		"database:\n  password: file://"+secretFile+"\n"), 0600))
+
+	os.Setenv("TEST_DB_USER", "admin")
+	defer os.Unsetenv("TEST_DB_USER")
+
+	vault := SecretResolverFunc(func(ref string) (string, error) {
+		return "token-for-" + ref, nil
+	})
+
+	var cfg secretConfig
+	require.NoError(t, Load(&cfg, WithFile(file), WithSecretResolver("vault", vault)))
+	assert.Equal(t, "localhost", cfg.Database.Host)
+	assert.Equal(t, "admin", cfg.Database.User)
+	assert.Equal(t, "s3cr3t", cfg.Database.Password)
+	assert.Equal(t, "token-for-app/token", cfg.Token)
+	assert.Equal(t, []string{"kafka:9092"}, cfg.Brokers)
+
+	out := Sprint(&cfg)
+	assert.Contains(t, out, "database.password=******\n")
+	assert.Contains(t, out, "token=******\n")
+	assert.False(t, strings.Contains(out, "s3cr3t"))
+
+	err = Load(&secretConfig{}, WithFile(file), WithSecrets())
+	assert.EqualError(t, err, "failed to resolve value of 'token': no secret resolver for scheme 'vault'")
+}
+
+func TestLoad_SecretsOptIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "app.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("database:\n  host: file:///no/such/file\n"+
+		"  user: ${TEST_UNSET_USER}\n"), 0600))
+
+	var cfg secretConfig
+	require.NoError(t, Load(&cfg, WithFile(file)))
+	assert.Equal(t, "file:///no/such/file", cfg.Database.Host, "values must be used as is by default")
+	assert.Equal(t, "${TEST_UNSET_USER}", cfg.Database.User)
+	assert.Equal(t, "${vault:app/token}", cfg.Token)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("database:\n  user: ${TEST_UNSET_USER}\n"), 0600))
+	vault := SecretResolverFunc(func(ref string) (string, error) { return ref, nil })
+	err = Load(&secretConfig{}, WithFile(file), WithSecretResolver("vault", vault))
+	assert.EqualError(t, err, "failed to resolve value of 'database.user': env variable 'TEST_UNSET_USER' is not set")
+}
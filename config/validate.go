@@ -0,0 +1,256 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Validator can be implemented by config structs to validate the values
+// after loading. It is invoked after the `validate` tags are checked.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned by Load when one or more keys have invalid
+// values as per their `validate` tags. Only the first failing rule of each
+// key is reported.
+//
+// Supported rules (comma separated): required, min=N, max=N, oneof=a b c,
+// url, duration and regexp=EXPR. Since regexp may contain commas, it must
+// be the last rule in the tag. min and max check the length of strings,
+// slices and maps and the value of numbers (durations for time.Duration).
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Violation represents a single failed rule for a key.
+type Violation struct {
+	Key    string
+	Doc    string
+	Rule   string
+	Reason string
+}
+
+func (ve *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("invalid config:")
+	for _, v := range ve.Violations {
+		sb.WriteString(fmt.Sprintf("\n  - %s: %s", v.Key, v.Reason))
+		if v.Doc != "" {
+			sb.WriteString(fmt.Sprintf(" (%s)", v.Doc))
+		}
+	}
+	return sb.String()
+}
+
+// validate checks the values in structPtr against the `validate` tags and
+// invokes Validator if implemented.
+func validate(structPtr interface{}) error {
+	defs, err := readRecursive(deref(reflect.ValueOf(structPtr)), "")
+	if err != nil {
+		return err
+	}
+
+	ve := &ValidationError{}
+	for _, def := range defs {
+		if def.Validate == "" {
+			continue
+		}
+
+		rules, err := parseRules(def.Validate)
+		if err != nil {
+			return fmt.Errorf("invalid validate tag for '%s': %v", def.Key, err)
+		}
+
+		for _, r := range rules {
+			reason, err := r.check(reflect.ValueOf(def.Default), def.Secret)
+			if err != nil {
+				return fmt.Errorf("invalid validate tag for '%s': %v", def.Key, err)
+			} else if reason != "" {
+				ve.Violations = append(ve.Violations, Violation{
+					Key:    def.Key,
+					Doc:    def.Doc,
+					Rule:   r.name,
+					Reason: reason,
+				})
+				break
+			}
+		}
+	}
+
+	if len(ve.Violations) > 0 {
+		return ve
+	}
+
+	if v, ok := structPtr.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+func parseRules(tag string) ([]rule, error) {
+	var rules []rule
+	for tag != "" {
+		part := tag
+		if strings.HasPrefix(part, "regexp=") {
+			tag = ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		r := rule{name: part}
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			r.name, r.param = part[:i], part[i+1:]
+		}
+
+		switch r.name {
+		case "required", "url", "duration":
+		case "min", "max", "oneof", "regexp":
+			if r.param == "" {
+				return nil, fmt.Errorf("rule '%s' needs a parameter", r.name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule '%s'", r.name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// check returns a non-empty reason if the value violates the rule. Except for
+// required, min and max, rules are not applied to empty values. If secret is
+// true, the reason does not mention the value (or its length) at all.
+func (r rule) check(v reflect.Value, secret bool) (string, error) {
+	if r.name == "required" {
+		if !v.IsValid() || v.IsZero() {
+			return "value is required", nil
+		}
+		return "", nil
+	}
+
+	if r.name == "min" || r.name == "max" {
+		return r.checkBound(v, secret)
+	}
+
+	if !v.IsValid() || v.IsZero() {
+		return "", nil
+	}
+	s := fmt.Sprint(v.Interface())
+
+	switch r.name {
+	case "oneof":
+		options := strings.Fields(r.param)
+		for _, opt := range options {
+			if s == opt {
+				return "", nil
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]%s", strings.Join(options, ", "), actualValue(secret, "'%s'", s)), nil
+
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be a valid URL" + actualValue(secret, "'%s'", s), nil
+		}
+
+	case "duration":
+		if v.Type() == durationType {
+			return "", nil
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return "must be a valid duration (e.g., 1m30s)" + actualValue(secret, "'%s'", s), nil
+		}
+
+	case "regexp":
+		re, err := regexp.Compile(r.param)
+		if err != nil {
+			return "", err
+		}
+		if !re.MatchString(s) {
+			return fmt.Sprintf("must match '%s'%s", r.param, actualValue(secret, "'%s'", s)), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (r rule) checkBound(v reflect.Value, secret bool) (string, error) {
+	if !v.IsValid() {
+		return "", nil
+	}
+
+	var actual float64
+	var unit string
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(r.param)
+		if err != nil {
+			return "", fmt.Errorf("rule '%s' needs a duration: %v", r.name, err)
+		}
+		if (r.name == "min" && v.Int() < int64(d)) || (r.name == "max" && v.Int() > int64(d)) {
+			return fmt.Sprintf("must be at %s %s%s", boundWord(r.name), d, actualValue(secret, "%s", time.Duration(v.Int()))), nil
+		}
+		return "", nil
+
+	case v.Kind() == reflect.String, v.Kind() == reflect.Slice, v.Kind() == reflect.Map, v.Kind() == reflect.Array:
+		actual, unit = float64(v.Len()), " in length"
+
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		actual = float64(v.Int())
+
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		actual = float64(v.Uint())
+
+	case v.Kind() == reflect.Float32, v.Kind() == reflect.Float64:
+		actual = v.Float()
+
+	default:
+		return "", fmt.Errorf("rule '%s' cannot be applied to '%s'", r.name, v.Kind())
+	}
+
+	limit, err := strconv.ParseFloat(r.param, 64)
+	if err != nil {
+		return "", fmt.Errorf("rule '%s' needs a number: %v", r.name, err)
+	}
+
+	if (r.name == "min" && actual < limit) || (r.name == "max" && actual > limit) {
+		return fmt.Sprintf("must be at %s %s%s%s", boundWord(r.name), r.param, unit, actualValue(secret, "%v", actual)), nil
+	}
+	return "", nil
+}
+
+// actualValue returns the ", not <value>" suffix of a reason, or an empty
+// string for secrets.
+func actualValue(secret bool, format string, v interface{}) string {
+	if secret {
+		return ""
+	}
+	return ", not " + fmt.Sprintf(format, v)
+}
+
+func boundWord(name string) string {
+	if name == "min" {
+		return "least"
+	}
+	return "most"
+}
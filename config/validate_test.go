@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validatedConfig struct {
+	Brokers  []string      `doc:"Kafka broker addresses" validate:"required,min=1"`
+	Level    string        `default:"info" validate:"oneof=debug info warn"`
+	Endpoint string        `validate:"url"`
+	Timeout  time.Duration `default:"1s" validate:"min=2s"`
+	Name     string        `doc:"Service name" default:"abcd,x" validate:"regexp=^[a-z]{1,3},x$"`
+	Port     int           `default:"70000" validate:"min=1,max=65535"`
+}
+
+func TestLoad_Validation(t *testing.T) {
+	var cfg validatedConfig
+	err := Load(&cfg)
+	require.Error(t, err)
+
+	ve, ok := err.(*ValidationError)
+	require.True(t, ok)
+
+	var keys []string
+	for _, v := range ve.Violations {
+		keys = append(keys, v.Key+":"+v.Rule)
+	}
+	assert.Equal(t, []string{"brokers:required", "timeout:min", "name:regexp", "port:max"}, keys)
+	assert.Contains(t, err.Error(), "brokers: value is required (Kafka broker addresses)")
+
+	cfg = validatedConfig{Brokers: []string{"localhost:9092"}, Endpoint: "http://localhost", Timeout: time.Minute, Name: "ab,x", Port: 80}
+	assert.NoError(t, validate(&cfg))
+
+	cfg.Level, cfg.Endpoint = "trace", "localhost"
+	assert.EqualError(t, validate(&cfg), "invalid config:\n"+
+		"  - level: must be one of [debug, info, warn], not 'trace'\n"+
+		"  - endpoint: must be a valid URL, not 'localhost'")
+}
+
+func TestValidate_Secret(t *testing.T) {
+	cfg := struct {
+		Mode     string `secret:"true" validate:"oneof=debug info"`
+		Password string `secret:"true" validate:"min=8"`
+	}{Mode: "e", Password: "short"}
+
+	err := validate(&cfg)
+	assert.EqualError(t, err, "invalid config:\n"+
+		"  - mode: must be one of [debug, info]\n"+
+		"  - password: must be at least 8 in length")
+}
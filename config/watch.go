@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultPollInterval = 1 * time.Second
+
+// ChangeFunc is called with the newly loaded config (same type as the struct
+// pointer passed to Watch) and the keys whose values have changed.
+type ChangeFunc func(cfg interface{}, changed []string)
+
+// Watch loads the config into structPtr and starts watching the config file
+// for changes until the ctx is cancelled. On every change, the file is loaded
+// into a fresh struct, validated (see Load) and then swapped in atomically.
+// structPtr itself is never modified after the initial load; use Current()
+// to access the latest config. onChange (if not nil) is called after a swap.
+func Watch(ctx context.Context, structPtr interface{}, onChange ChangeFunc, opts ...Option) (*Watcher, error) {
+	l, err := newLoader(structPtr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	file := l.viper.ConfigFileUsed()
+	if file == "" {
+		return nil, fmt.Errorf("no config file found to watch")
+	}
+
+	w := &Watcher{
+		file:     file,
+		opts:     append(append([]Option(nil), opts...), WithFile(file)),
+		interval: l.pollInterval,
+		onErr:    l.onReloadErr,
+	}
+	if w.interval == 0 {
+		w.interval = defaultPollInterval
+	}
+	if w.onErr == nil {
+		w.onErr = func(error) {}
+	}
+	if onChange != nil {
+		w.Subscribe(onChange)
+	}
+	w.current.Store(structPtr)
+
+	if err := w.stat(); err != nil {
+		return nil, err
+	}
+
+	go w.run(ctx)
+	return w, nil
+}
+
+// Watcher holds the latest config loaded by Watch.
+type Watcher struct {
+	file     string
+	opts     []Option
+	interval time.Duration
+	onErr    func(err error)
+	current  atomic.Value
+
+	mu   sync.Mutex
+	subs []ChangeFunc
+
+	modTime time.Time
+	size    int64
+	hash    []byte
+}
+
+// Current returns the latest config. The returned value is a pointer of the
+// same type as the struct pointer passed to Watch and must not be modified.
+func (w *Watcher) Current() interface{} { return w.current.Load() }
+
+// Subscribe registers fn to be called on every config change.
+func (w *Watcher) Subscribe(fn ChangeFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, fn)
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			changed, err := w.changed()
+			if err != nil {
+				w.onErr(err)
+				continue
+			}
+
+			if changed {
+				if err := w.reload(); err != nil {
+					w.onErr(err)
+				}
+			}
+		}
+	}
+}
+
+// changed checks the modification time and size of the file first and then
+// the content hash, since editors may rewrite files without any changes.
+func (w *Watcher) changed() (bool, error) {
+	fi, err := os.Stat(w.file)
+	if err != nil {
+		return false, err
+	}
+	if fi.ModTime().Equal(w.modTime) && fi.Size() == w.size {
+		return false, nil
+	}
+
+	hash := w.hash
+	if err := w.stat(); err != nil {
+		return false, err
+	}
+	return !bytes.Equal(hash, w.hash), nil
+}
+
+func (w *Watcher) stat() error {
+	fi, err := os.Stat(w.file)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(w.file)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	w.modTime, w.size, w.hash = fi.ModTime(), fi.Size(), sum[:]
+	return nil
+}
+
+func (w *Watcher) reload() error {
+	prev := w.Current()
+
+	fresh := reflect.New(reflect.TypeOf(prev).Elem()).Interface()
+	if err := Load(fresh, w.opts...); err != nil {
+		return err
+	}
+
+	keys, err := diff(prev, fresh)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	w.current.Store(fresh)
+
+	w.mu.Lock()
+	subs := append([]ChangeFunc(nil), w.subs...)
+	w.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(fresh, keys)
+	}
+	return nil
+}
+
+// diff returns the keys with different values in the two configs.
+func diff(prev, next interface{}) ([]string, error) {
+	prevDefs, err := readRecursive(deref(reflect.ValueOf(prev)), "")
+	if err != nil {
+		return nil, err
+	}
+
+	nextDefs, err := readRecursive(deref(reflect.ValueOf(next)), "")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for i, def := range nextDefs {
+		if !reflect.DeepEqual(prevDefs[i].Default, def.Default) {
+			keys = append(keys, def.Key)
+		}
+	}
+	return keys, nil
+}
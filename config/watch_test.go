@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type watchConfig struct {
+	Addr  string `default:":8080"`
+	Debug bool
+	Store struct {
+		Host string `default:"localhost"`
+		Port int    `default:"5432"`
+	}
+}
+
+func (c *watchConfig) Validate() error {
+	if c.Store.Port <= 0 {
+		return errors.New("store port must be positive")
+	}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "app.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("addr: ':9090'\n"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan []string, 1)
+	errs := make(chan error, 1)
+
+	var cfg watchConfig
+	w, err := Watch(ctx, &cfg, func(_ interface{}, changed []string) {
+		changes <- changed
+	}, WithFile(file), WithPollInterval(10*time.Millisecond), WithReloadErrorHandler(func(err error) {
+		errs <- err
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, ":9090", cfg.Addr)
+	assert.Equal(t, "localhost", cfg.Store.Host)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("addr: ':9090'\nstore:\n  host: db.local\n"), 0600))
+	select {
+	case changed := <-changes:
+		assert.Equal(t, []string{"store.host"}, changed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("change was not detected")
+	}
+	assert.Equal(t, "db.local", w.Current().(*watchConfig).Store.Host)
+	assert.Equal(t, 5432, w.Current().(*watchConfig).Store.Port)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("store:\n  port: -1\n"), 0600))
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "store port must be positive")
+	case <-time.After(2 * time.Second):
+		t.Fatal("invalid config was not rejected")
+	}
+	assert.Equal(t, "db.local", w.Current().(*watchConfig).Store.Host)
+}
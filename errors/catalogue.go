@@ -0,0 +1,278 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultLocale is the locale of the templates registered in the catalogue
+// and the fallback when no requested locale is available.
+const DefaultLocale = "en"
+
+var placeholderRe = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// DefaultCatalogue holds the error types defined in this package and is used
+// by Error.WriteFor to localize messages.
+var DefaultCatalogue = NewCatalogue(
+	Entry{Type: "EmptyField", Status: http.StatusBadRequest, Code: "empty_field", Template: "{param} cannot be empty"},
+	Entry{Type: "NoSuchUser", Status: http.StatusUnauthorized, Code: "no_such_user", Template: "No user found with id '{id}'"},
+	Entry{Type: "MissingCredentials", Status: http.StatusUnauthorized, Code: "missing_credentials", Template: "Authentication credentials are missing"},
+	Entry{Type: "Unauthenticated", Status: http.StatusUnauthorized, Code: "unauthenticated", Template: "Wrong credentials provided or user does not exist"},
+	Entry{Type: "Unauthorized", Status: http.StatusForbidden, Code: "unauthorized", Template: "You do not have permission to {action} resource {resource}"},
+	Entry{Type: "MethodNotAllowed", Status: http.StatusMethodNotAllowed, Code: "method_not_allowed"},
+	Entry{Type: "MissingParameter", Status: http.StatusBadRequest, Code: "missing_parameter", Template: "A value is required for parameter '{param}'"},
+	Entry{Type: "BadRequest", Status: http.StatusBadRequest, Code: "bad_request"},
+	Entry{Type: "BadSpecification", Status: http.StatusBadRequest, Code: "bad_specification", Template: "Specification is invalid"},
+	Entry{Type: "NotFound", Status: http.StatusNotFound, Code: "not_found", Template: "Path '{path}' not found"},
+	Entry{Type: "ResourceNotFound", Status: http.StatusNotFound, Code: "resource_not_found", Template: "{type} not found with id '{id}'"},
+	Entry{Type: "Conflict", Status: http.StatusConflict, Code: "conflict", Template: "Resource of type '{type}' already exists with id '{id}'"},
+	Entry{Type: "ValidationFailed", Status: http.StatusBadRequest, Code: "validation_failed"},
+	Entry{Type: "MultipleErrors", Status: http.StatusInternalServerError, Code: "multiple_errors"},
+	Entry{Type: "Unknown", Status: http.StatusInternalServerError, Code: "unknown"},
+)
+
+// Entry describes an error type in the catalogue.
+type Entry struct {
+	Type   string // camel-cased type name (e.g., ResourceNotFound).
+	Status int    // HTTP status code.
+
+	// Code is a stable, machine readable identifier for the error type.
+	// It is sent to clients as Error.ErrorCode.
+	Code string
+
+	// Template is the message in DefaultLocale. Placeholders of the form
+	// '{name}' are replaced with the values from Error.Details (or the
+	// private message args of the error).
+	Template string
+}
+
+// NewCatalogue returns a catalogue with the given entries registered.
+func NewCatalogue(entries ...Entry) *Catalogue {
+	c := &Catalogue{
+		entries: map[string]Entry{},
+		locales: map[string]map[string]string{},
+	}
+	for _, e := range entries {
+		c.Register(e)
+	}
+	return c
+}
+
+// Catalogue is a registry of error types with their message templates in
+// multiple locales. Catalogue is safe for concurrent use.
+type Catalogue struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+	locales map[string]map[string]string // locale -> type -> template
+}
+
+// Register adds or replaces the entry for the error type.
+func (c *Catalogue) Register(e Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[e.Type] = e
+}
+
+// Lookup returns the entry registered for the error type.
+func (c *Catalogue) Lookup(typ string) (Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, found := c.entries[typ]
+	return e, found
+}
+
+// New creates an Error of the registered type with message rendered from the
+// template in DefaultLocale. Panics if the type is not registered.
+func (c *Catalogue) New(typ string, details map[string]interface{}) *Error {
+	entry, found := c.Lookup(typ)
+	if !found {
+		panic(fmt.Sprintf("errors: type '%s' is not registered", typ))
+	}
+
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	msg, _ := render(entry.Template, details, nil)
+
+	return &Error{
+		Code:      entry.Status,
+		Type:      entry.Type,
+		ErrorCode: entry.Code,
+		Message:   msg,
+		Details:   details,
+	}
+}
+
+// AddLocale registers message templates (type -> template) for the locale.
+// Templates are merged with the ones already registered for the locale.
+func (c *Catalogue) AddLocale(locale string, templates map[string]string) {
+	locale = normaliseLocale(locale)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, found := c.locales[locale]
+	if !found {
+		m = map[string]string{}
+		c.locales[locale] = m
+	}
+	for typ, tpl := range templates {
+		m[typ] = tpl
+	}
+}
+
+// LoadLocale reads templates for the locale from r. The format must be either
+// 'json' or 'yaml'. The content must be a map of error type to template.
+func (c *Catalogue) LoadLocale(locale string, r io.Reader, format string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	templates := map[string]string{}
+	switch strings.ToLower(format) {
+	case "json":
+		err = json.Unmarshal(data, &templates)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &templates)
+	default:
+		return fmt.Errorf("unsupported catalogue format '%s'", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse catalogue for '%s': %v", locale, err)
+	}
+
+	c.AddLocale(locale, templates)
+	return nil
+}
+
+// LoadLocaleFile loads the templates from the file. The locale and the format
+// are derived from the file name (e.g., 'fr.yaml', 'pt-BR.json').
+func (c *Catalogue) LoadLocaleFile(path string) error {
+	ext := filepath.Ext(path)
+	locale := strings.TrimSuffix(filepath.Base(path), ext)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return c.LoadLocale(locale, strings.NewReader(string(data)), strings.TrimPrefix(ext, "."))
+}
+
+// Message returns the message of the error rendered in the first of the
+// given locales for which a template exists. Falls back to the Message of
+// the error (which is in DefaultLocale) if DefaultLocale is preferred or if
+// none of the templates can be rendered using the error details.
+func (c *Catalogue) Message(e Error, locales ...string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, locale := range locales {
+		locale = normaliseLocale(locale)
+		candidates := []string{locale}
+		if i := strings.IndexByte(locale, '-'); i > 0 {
+			candidates = append(candidates, locale[:i])
+		}
+
+		for _, l := range candidates {
+			if l == DefaultLocale {
+				return e.Message
+			}
+			if tpl, found := c.locales[l][e.Type]; found {
+				if msg, ok := render(tpl, e.Details, e.args); ok {
+					return msg
+				}
+			}
+		}
+	}
+
+	return e.Message
+}
+
+// Localize returns a copy of the error with the message rendered in the best
+// locale as per the Accept-Language header of the request.
+func (c *Catalogue) Localize(e Error, r *http.Request) Error {
+	if r == nil {
+		return e
+	}
+
+	langs := acceptLanguages(r.Header.Get("Accept-Language"))
+	if len(langs) > 0 {
+		e.Message = c.Message(e, langs...)
+	}
+	return e
+}
+
+// render replaces the placeholders in the template with values from details.
+// Returns false if any placeholder has no value.
+// render fills the placeholders in tpl from details and then from args.
+func render(tpl string, details, args map[string]interface{}) (string, bool) {
+	ok := true
+	msg := placeholderRe.ReplaceAllStringFunc(tpl, func(ph string) string {
+		name := ph[1 : len(ph)-1]
+		v, found := details[name]
+		if !found {
+			v, found = args[name]
+		}
+		if !found {
+			ok = false
+			return ph
+		}
+		return fmt.Sprint(v)
+	})
+	return msg, ok
+}
+
+// acceptLanguages parses the Accept-Language header and returns the language
+// tags in decreasing order of preference.
+func acceptLanguages(header string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+
+	var langs []lang
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, lang{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+func normaliseLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
@@ -0,0 +1,91 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCatalogue_Localize(t *testing.T) {
+	cat := NewCatalogue(Entry{
+		Type:     "ResourceNotFound",
+		Status:   http.StatusNotFound,
+		Code:     "resource_not_found",
+		Template: "{type} not found with id '{id}'",
+	})
+
+	fr := `ResourceNotFound: "{type} introuvable avec l'id '{id}'"`
+	if err := cat.LoadLocale("fr", strings.NewReader(fr), "yaml"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	de := `{"ResourceNotFound": "{type} mit ID '{id}' ({missing}) nicht gefunden"}`
+	if err := cat.LoadLocale("de", strings.NewReader(de), "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	e := cat.New("ResourceNotFound", map[string]interface{}{"id": "bob", "type": "User"})
+	if e.ErrorCode != "resource_not_found" || e.Message != "User not found with id 'bob'" {
+		t.Fatalf("unexpected error: %#v", e)
+	}
+
+	tests := map[string]string{
+		"":                       "User not found with id 'bob'",
+		"fr-CA, en;q=0.8":        "User introuvable avec l'id 'bob'",
+		"en-US, fr;q=0.8":        "User not found with id 'bob'",
+		"es, fr;q=0.5, en;q=0.9": "User not found with id 'bob'",
+		"de":                     "User not found with id 'bob'",
+		"de;q=0.9, fr_FR;q=0.5":  "User introuvable avec l'id 'bob'",
+		"fr;q=0, it":             "User not found with id 'bob'",
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", header)
+
+		if got := cat.Localize(*e, r).Message; got != want {
+			t.Errorf("Accept-Language '%s': expected '%s', got '%s'", header, want, got)
+		}
+	}
+}
+
+func TestError_WriteLocalized(t *testing.T) {
+	entry, _ := DefaultCatalogue.Lookup("EmptyField")
+	cat := NewCatalogue(entry)
+	cat.AddLocale("nl", map[string]string{"EmptyField": "{param} mag niet leeg zijn"})
+
+	orig := DefaultCatalogue
+	DefaultCatalogue = cat
+	defer func() { DefaultCatalogue = orig }()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "nl-BE")
+	rec := httptest.NewRecorder()
+	if err := ErrEmptyParam("name").WriteFor(rec, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got Error
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Message != "name mag niet leeg zijn" || got.ErrorCode != "empty_field" {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+}
+
+func TestErrNoSuchUser(t *testing.T) {
+	e := ErrNoSuchUser("bob")
+	if e.Message != "No user found with id 'bob'" || e.ErrorCode != "no_such_user" {
+		t.Errorf("unexpected error: %#v", e)
+	}
+	if _, found := e.Details["id"]; found {
+		t.Errorf("user id must not be exposed in details: %v", e.Details)
+	}
+
+	cat := NewCatalogue()
+	cat.AddLocale("fr", map[string]string{"NoSuchUser": "Aucun utilisateur avec l'id '{id}'"})
+	if got := cat.Message(*e, "fr"); got != "Aucun utilisateur avec l'id 'bob'" {
+		t.Errorf("expected localized message with the id, got '%s'", got)
+	}
+}
@@ -0,0 +1,150 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody is the maximum number of bytes read from an error response.
+const maxErrorBody = 1 << 20
+
+var problemMembers = map[string]bool{
+	"type": true, "title": true, "status": true, "detail": true, "instance": true,
+	"error_code": true,
+}
+
+// FromResponse returns an *Error representing the error response. Returns nil
+// if the response status is not 4xx or 5xx. Bodies written by Error.WriteFor in
+// legacy JSON, problem+json or plain text formats are decoded to restore the
+// Code, Type, Message and Details. The response body is buffered and can be
+// read again by the caller.
+func FromResponse(resp *http.Response) error {
+	if resp == nil || resp.StatusCode < 400 {
+		return nil
+	}
+
+	var body []byte
+	if resp.Body != nil {
+		b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		_ = resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if err != nil {
+			return ErrConnection(err)
+		}
+		body = b
+	}
+
+	e := &Error{
+		Code:    resp.StatusCode,
+		Type:    typeFromStatus(resp.StatusCode),
+		Details: map[string]interface{}{},
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == contentTypeProblem:
+		decodeProblem(e, body)
+
+	case mediaType == contentTypeJSON || strings.HasSuffix(mediaType, "+json"):
+		decodeLegacy(e, body)
+
+	default:
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+// Transport is an http.RoundTripper that turns 4xx and 5xx responses into
+// *Error using FromResponse. http.Client wraps the returned error in a
+// *url.Error, so callers should use errors.As to inspect it.
+type Transport struct {
+	// Base is the underlying RoundTripper. If nil, http.DefaultTransport
+	// is used.
+	Base http.RoundTripper
+}
+
+// RoundTrip executes the request using the base transport and returns error
+// for unsuccessful responses.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := FromResponse(resp); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func decodeLegacy(e *Error, body []byte) {
+	var legacy Error
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		e.Message = strings.TrimSpace(string(body))
+		return
+	}
+
+	if legacy.Code != 0 {
+		e.Code = legacy.Code
+	}
+	if legacy.Type != "" {
+		e.Type = legacy.Type
+	}
+	if legacy.Details != nil {
+		e.Details = legacy.Details
+	}
+	e.ErrorCode = legacy.ErrorCode
+	e.Message = legacy.Message
+}
+
+func decodeProblem(e *Error, body []byte) {
+	var problem map[string]interface{}
+	if err := json.Unmarshal(body, &problem); err != nil {
+		e.Message = strings.TrimSpace(string(body))
+		return
+	}
+
+	if status, ok := problem["status"].(float64); ok && status > 0 {
+		e.Code = int(status)
+	}
+	if typ, ok := problem["type"].(string); ok && typ != "" && typ != "about:blank" {
+		e.Type = strings.TrimPrefix(typ, ProblemTypeBase)
+	}
+	if detail, ok := problem["detail"].(string); ok {
+		e.Message = detail
+	}
+	if code, ok := problem["error_code"].(string); ok {
+		e.ErrorCode = code
+	}
+
+	for k, v := range problem {
+		if !problemMembers[k] {
+			e.Details[k] = v
+		}
+	}
+}
+
+// typeFromStatus returns a camel-cased type name derived from the status
+// text (e.g., 'Not Found' to 'NotFound').
+func typeFromStatus(code int) string {
+	text := http.StatusText(code)
+	if text == "" {
+		return "Unknown"
+	}
+	return strings.NewReplacer(" ", "", "-", "").Replace(text)
+}
@@ -2,8 +2,11 @@ package errors
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"io"
 	"net/http"
+	"runtime"
 )
 
 // Error implements the error interface and provides certain additional fields.
@@ -20,6 +23,10 @@ type Error struct {
 	// MissingParameter etc. which are all bad requests
 	Type string `json:"type"`
 
+	// ErrorCode is a stable, machine readable identifier for the error type
+	// as registered in the Catalogue (e.g., resource_not_found).
+	ErrorCode string `json:"error_code,omitempty"`
+
 	// Details provides any additional information about the error. For example,
 	// in case of MissingParameter error, details will contain the name of the
 	// missing parameter.
@@ -28,6 +35,13 @@ type Error struct {
 	// Message is a string which can be directly shown to user. This should
 	// not contain any technical errors.
 	Message string `json:"message,omitempty"`
+
+	cause error
+	stack []uintptr
+
+	// args are used along with Details to render localized messages, but
+	// are not sent to clients.
+	args map[string]interface{}
 }
 
 func (e Error) String() string {
@@ -43,11 +57,109 @@ func (e Error) Error() string {
 // ResponseWriter. The `Code` field will also be sent as StatusCode in
 // the response.
 func (e Error) Write(w http.ResponseWriter) error {
-	code := e.Code
-	if code < 400 {
-		code = http.StatusInternalServerError
+	return writeJSON(w, e.statusCode(), e)
+}
+
+// WriteFor is like Write but chooses the format based on the Accept header
+// of the request: 'application/problem+json' (RFC 7807), 'text/plain' or
+// the legacy JSON format of Error (default, also used if r is nil). Message
+// is localized using DefaultCatalogue as per the Accept-Language header.
+func (e Error) WriteFor(w http.ResponseWriter, r *http.Request) error {
+	code := e.statusCode()
+	e = DefaultCatalogue.Localize(e, r)
+
+	switch negotiate(r) {
+	case contentTypeProblem:
+		return writeBody(w, code, contentTypeProblem, e.Problem(r))
+
+	case contentTypeText:
+		w.Header().Set("Content-Type", contentTypeText+"; charset=utf-8")
+		w.WriteHeader(code)
+		_, err := fmt.Fprintln(w, e.Message)
+		return err
+
+	default:
+		return writeJSON(w, code, e)
+	}
+}
+
+func (e Error) statusCode() int {
+	if e.Code < 400 {
+		return http.StatusInternalServerError
 	}
-	return writeJSON(w, code, e)
+	return e.Code
+}
+
+// Unwrap returns the underlying cause of the error (if any). This allows
+// errors.Is and errors.As to inspect the cause chain.
+func (e Error) Unwrap() error { return e.cause }
+
+// Is returns true if the target is an Error with same Type and Code. Empty
+// Type or zero Code in the target matches any value. This allows checks such
+// as `errors.Is(err, &Error{Type: "ResourceNotFound"})`.
+func (e Error) Is(target error) bool {
+	var t Error
+	switch v := target.(type) {
+	case *Error:
+		if v == nil {
+			return false
+		}
+		t = *v
+	case Error:
+		t = v
+	default:
+		return false
+	}
+
+	if t.Type == "" && t.Code == 0 {
+		return false
+	}
+	return (t.Type == "" || t.Type == e.Type) && (t.Code == 0 || t.Code == e.Code)
+}
+
+// Format implements fmt.Formatter. '%+v' prints the error along with the
+// cause chain and the stack trace (if captured).
+func (e Error) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if f.Flag('+') {
+			_, _ = io.WriteString(f, e.Error())
+			for cause := e.cause; cause != nil; cause = stderrors.Unwrap(cause) {
+				fmt.Fprintf(f, "\ncaused by: %s", cause)
+			}
+			if len(e.stack) > 0 {
+				_, _ = io.WriteString(f, "\nstack:")
+				frames := runtime.CallersFrames(e.stack)
+				for {
+					frame, more := frames.Next()
+					fmt.Fprintf(f, "\n  %s\n    %s:%d", frame.Function, frame.File, frame.Line)
+					if !more {
+						break
+					}
+				}
+			}
+			return
+		}
+		_, _ = io.WriteString(f, e.Error())
+
+	case 's':
+		_, _ = io.WriteString(f, e.Error())
+
+	case 'q':
+		fmt.Fprintf(f, "%q", e.Error())
+	}
+}
+
+// WithCause sets the underlying cause of the error.
+func (e *Error) WithCause(err error) *Error {
+	e.cause = err
+	return e
+}
+
+// WithStack captures the stack trace of the caller into the error.
+func (e *Error) WithStack() *Error {
+	e.stack = callers(3)
+	return e
 }
 
 // SetCode sets the value of code field
@@ -65,7 +177,11 @@ func (e *Error) SetMessage(msg string) *Error {
 // writeJSON serializes given interface using JSON encoder and writes it
 // to given http.ResponseWriter object with StatusCode set to `code`.
 func writeJSON(w http.ResponseWriter, code int, v interface{}) error {
-	w.Header().Add("Content-type", "application/json")
+	return writeBody(w, code, contentTypeJSON, v)
+}
+
+func writeBody(w http.ResponseWriter, code int, contentType string, v interface{}) error {
+	w.Header().Add("Content-type", contentType)
 	w.WriteHeader(code)
 	return json.NewEncoder(w).Encode(v)
 }
@@ -74,3 +190,37 @@ func writeJSON(w http.ResponseWriter, code int, v interface{}) error {
 func New(format string, args ...interface{}) *Error {
 	return ErrUnexpected(fmt.Errorf(format, args...))
 }
+
+// Wrap returns an Error of given code and type with the err as the cause. If
+// msg is empty, the cause's message is used.
+func Wrap(err error, code int, typ, msg string) *Error {
+	if msg == "" && err != nil {
+		msg = err.Error()
+	}
+
+	return capture(&Error{
+		Code:    code,
+		Type:    typ,
+		Message: msg,
+		Details: map[string]interface{}{},
+		cause:   err,
+	})
+}
+
+// CaptureStack enables capturing the stack trace when errors are created using
+// the constructors in this package. Stack traces are printed with '%+v'.
+var CaptureStack = false
+
+// capture records the stack trace of the constructor's caller if enabled.
+func capture(e *Error) *Error {
+	if CaptureStack {
+		e.stack = callers(4)
+	}
+	return e
+}
+
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip, pcs)
+	return pcs[:n]
+}
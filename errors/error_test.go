@@ -0,0 +1,142 @@
+package errors
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestError_Is(t *testing.T) {
+	err := ErrUnexpected(fmt.Errorf("read failed: %w", io.EOF))
+
+	if !stderrors.Is(err, io.EOF) {
+		t.Errorf("expected cause to match io.EOF")
+	}
+
+	if !stderrors.Is(err, &Error{Type: "Unknown"}) {
+		t.Errorf("expected match by type")
+	}
+
+	if stderrors.Is(err, &Error{Type: "Unknown", Code: http.StatusNotFound}) {
+		t.Errorf("expected no match for different code")
+	}
+
+	var wrapped error = ErrResourceNotFound("1", "User")
+	wrapped = fmt.Errorf("lookup: %w", wrapped)
+
+	var target *Error
+	if !stderrors.As(wrapped, &target) || target.Type != "ResourceNotFound" {
+		t.Errorf("expected errors.As to find *Error, got %#v", target)
+	}
+}
+
+func TestError_Write(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := ErrResourceNotFound("1", "User").Write(rec); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected content-type 'application/json', got '%s'", got)
+	}
+
+	var got Error
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Type != "ResourceNotFound" {
+		t.Errorf("unexpected response (err=%v): %s", err, rec.Body.String())
+	}
+}
+
+func TestError_WriteFor(t *testing.T) {
+	table := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/problem+json", "application/problem+json"},
+		{"application/json;q=0.5, application/problem+json", "application/problem+json"},
+		{"text/html, text/plain;q=0.8", "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.accept, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("Accept", tt.accept)
+
+			if err := ErrResourceNotFound("1", "User").WriteFor(rec, req); err != nil {
+				t.Fatalf("WriteFor() unexpected error: %v", err)
+			}
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("expected status 404, got %d", rec.Code)
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected content-type '%s', got '%s'", tt.contentType, got)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	_ = ErrMissingParam("name").WriteFor(rec, req)
+
+	var problem map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid problem json: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"type":     "MissingParameter",
+		"title":    "Missing Parameter",
+		"status":   float64(400),
+		"detail":   "A value is required for parameter 'name'",
+		"instance": "/users/1",
+		"param":    "name",
+	}
+	for k, v := range want {
+		if problem[k] != v {
+			t.Errorf("expected problem[%s]=%v, got %v", k, v, problem[k])
+		}
+	}
+}
+
+func TestFromResponse(t *testing.T) {
+	for _, accept := range []string{"application/json", "application/problem+json", "text/plain"} {
+		t.Run(accept, func(t *testing.T) {
+			srv := httptest.NewServer(Handler(func(w http.ResponseWriter, r *http.Request) error {
+				return ErrResourceNotFound("bob", "Person")
+			}))
+			defer srv.Close()
+
+			client := &http.Client{Transport: &Transport{}}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			req.Header.Set("Accept", accept)
+
+			_, err := client.Do(req)
+
+			var e *Error
+			if !stderrors.As(err, &e) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+
+			if e.Code != http.StatusNotFound || e.Message != "Person not found with id 'bob'" {
+				t.Errorf("unexpected error: %#v", e)
+			}
+
+			if accept != "text/plain" && (e.Type != "ResourceNotFound" || e.Details["id"] != "bob") {
+				t.Errorf("expected type and details to be restored, got %#v", e)
+			}
+		})
+	}
+}
@@ -1 +1,5 @@
 module github.com/spy16/canister/errors
+
+go 1.15
+
+require gopkg.in/yaml.v2 v2.4.0
@@ -0,0 +1,12 @@
+module github.com/spy16/canister/errors/grpcerr
+
+go 1.15
+
+require (
+	github.com/spy16/canister/errors v0.0.0
+	google.golang.org/genproto v0.0.0-20220407144326-9054f6ed7bac
+	google.golang.org/grpc v1.45.0
+	google.golang.org/protobuf v1.28.0
+)
+
+replace github.com/spy16/canister/errors => ../
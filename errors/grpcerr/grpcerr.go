@@ -0,0 +1,220 @@
+// Package grpcerr maps errors.Error to and from gRPC status and provides
+// server interceptors that do the conversion. It lives in its own module
+// so that HTTP-only users of errors do not depend on gRPC.
+package grpcerr
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/spy16/canister/errors"
+)
+
+// ErrorDomain is used as the domain of the ErrorInfo detail attached to the
+// gRPC status created from an Error.
+const ErrorDomain = "github.com/spy16/canister/errors"
+
+const (
+	httpCodeKey  = "http_code"
+	errorCodeKey = "error_code"
+)
+
+var httpToGRPC = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusMethodNotAllowed:    codes.Unimplemented,
+	http.StatusRequestTimeout:      codes.DeadlineExceeded,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	499:                            codes.Canceled,
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+var grpcToHTTP = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusPreconditionFailed,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// typeToGRPC overrides the code mapping for error types whose Code is not
+// an HTTP status code.
+var typeToGRPC = map[string]codes.Code{
+	"ConnectionError": codes.Unavailable,
+	"ConversionError": codes.InvalidArgument,
+}
+
+// Code returns the gRPC status code equivalent to the HTTP status code.
+func Code(httpCode int) codes.Code {
+	if c, found := httpToGRPC[httpCode]; found {
+		return c
+	}
+
+	switch {
+	case httpCode >= 200 && httpCode < 300:
+		return codes.OK
+	case httpCode >= 400 && httpCode < 500:
+		return codes.FailedPrecondition
+	default:
+		return codes.Unknown
+	}
+}
+
+// HTTPCode returns the HTTP status code equivalent to the gRPC status code.
+func HTTPCode(c codes.Code) int {
+	if code, found := grpcToHTTP[c]; found {
+		return code
+	}
+	return http.StatusInternalServerError
+}
+
+// Status returns the gRPC status equivalent of the error. The Type and the
+// original Code are attached as an ErrorInfo detail and Details as a Struct
+// detail so that FromStatus can restore the Error.
+func Status(e errors.Error) *status.Status {
+	c, found := typeToGRPC[e.Type]
+	if !found {
+		c = Code(e.Code)
+	}
+
+	st := status.New(c, e.Message)
+
+	info := &errdetails.ErrorInfo{
+		Reason:   e.Type,
+		Domain:   ErrorDomain,
+		Metadata: map[string]string{httpCodeKey: strconv.Itoa(e.Code)},
+	}
+	if e.ErrorCode != "" {
+		info.Metadata[errorCodeKey] = e.ErrorCode
+	}
+
+	withDetails, err := st.WithDetails(info)
+	if s, structErr := toStruct(e.Details); structErr == nil && len(e.Details) > 0 {
+		withDetails, err = st.WithDetails(info, s)
+	}
+
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// FromStatus returns the Error equivalent of the gRPC status. Errors created
+// by Status are restored with the original Code, Type and Details. Returns
+// nil if the status code is OK.
+func FromStatus(st *status.Status) *errors.Error {
+	if st == nil || st.Code() == codes.OK {
+		return nil
+	}
+
+	e := &errors.Error{
+		Code:    HTTPCode(st.Code()),
+		Type:    st.Code().String(),
+		Message: st.Message(),
+		Details: map[string]interface{}{},
+	}
+
+	for _, d := range st.Details() {
+		switch v := d.(type) {
+		case *errdetails.ErrorInfo:
+			if v.GetDomain() != ErrorDomain {
+				continue
+			}
+			e.Type = v.GetReason()
+			if code, err := strconv.Atoi(v.GetMetadata()[httpCodeKey]); err == nil {
+				e.Code = code
+			}
+			e.ErrorCode = v.GetMetadata()[errorCodeKey]
+
+		case *structpb.Struct:
+			for k, val := range v.AsMap() {
+				e.Details[k] = val
+			}
+		}
+	}
+
+	return e
+}
+
+// FromError converts the error returned by a gRPC call into Error. If the
+// err is not a gRPC status error, it is treated as an unexpected error.
+func FromError(err error) *errors.Error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return errors.ErrUnexpected(err)
+	}
+	return FromStatus(st).WithCause(err)
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor that converts any Error
+// (including wrapped ones) returned by the handler into gRPC status.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, toStatusErr(err)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor that converts any Error
+// (including wrapped ones) returned by the stream handler into gRPC status.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return toStatusErr(handler(srv, ss))
+	}
+}
+
+func toStatusErr(err error) error {
+	var e *errors.Error
+	if err == nil || !stderrors.As(err, &e) {
+		return err
+	}
+	return Status(*e).Err()
+}
+
+// toStruct converts the details into protobuf Struct. Values are normalised
+// through JSON so that any JSON serialisable value is supported.
+func toStruct(details map[string]interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalised map[string]interface{}
+	if err := json.Unmarshal(data, &normalised); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(normalised)
+}
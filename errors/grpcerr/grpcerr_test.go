@@ -0,0 +1,64 @@
+package grpcerr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spy16/canister/errors"
+)
+
+func TestStatus(t *testing.T) {
+	orig := errors.ErrResourceNotFound("bob", "User")
+
+	st, ok := status.FromError(Status(*orig).Err())
+	if !ok {
+		t.Fatalf("expected status.FromError to recognise the status error")
+	}
+
+	if st.Code() != codes.NotFound {
+		t.Errorf("expected code NotFound, got %s", st.Code())
+	}
+
+	got := FromStatus(st)
+	if got.Code != orig.Code || got.Type != orig.Type || got.Message != orig.Message {
+		t.Errorf("expected %#v, got %#v", orig, got)
+	}
+
+	if !reflect.DeepEqual(got.Details, orig.Details) {
+		t.Errorf("expected details %v, got %v", orig.Details, got.Details)
+	}
+
+	plain := FromStatus(status.New(codes.PermissionDenied, "nope"))
+	if plain.Code != http.StatusForbidden || plain.Type != "PermissionDenied" {
+		t.Errorf("unexpected error from plain status: %#v", plain)
+	}
+
+	if FromStatus(status.New(codes.OK, "")) != nil {
+		t.Errorf("expected nil for OK status")
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	intercept := UnaryServerInterceptor()
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		var err error = errors.ErrConflict("1", "User")
+		return nil, fmt.Errorf("create failed: %w", err)
+	}
+
+	_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists, got %s", status.Code(err))
+	}
+
+	if e := FromError(err); e.Type != "Conflict" || e.Code != http.StatusConflict {
+		t.Errorf("unexpected error: %#v", e)
+	}
+}
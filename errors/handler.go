@@ -0,0 +1,228 @@
+package errors
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+// DefaultRequestIDHeader is the header used by Handler to read and write the
+// request id.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// Logger is used by Handler to log unexpected errors and panics. Logger from
+// github.com/spy16/pkg/log satisfies this interface.
+type Logger interface {
+	Errorf(msg string, args ...interface{})
+}
+
+// HandlerFunc is an HTTP handler func that can return an error.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// HandlerOption can be passed to Handler to customise its behaviour.
+type HandlerOption func(h *errHandler)
+
+// WithLogger sets the logger to be used for logging unexpected errors and
+// panics. If nil, logging is disabled.
+func WithLogger(lg Logger) HandlerOption {
+	return func(h *errHandler) { h.logger = lg }
+}
+
+// WithProduction enables production mode in which the internal details of
+// unexpected errors (i.e., errors that are not *Error) are not sent to the
+// client.
+func WithProduction(enable bool) HandlerOption {
+	return func(h *errHandler) { h.production = enable }
+}
+
+// WithRequestIDHeader sets the header to read the request id from. If the
+// request has no id, a random id is generated. The id is echoed back in the
+// same response header and included in the error details.
+func WithRequestIDHeader(header string) HandlerOption {
+	return func(h *errHandler) { h.requestIDHeader = header }
+}
+
+// Handler adapts the fn into http.Handler. Errors returned by fn and panics
+// are converted to *Error (see From) and written to the response using
+// Error.WriteFor.
+func Handler(fn HandlerFunc, opts ...HandlerOption) http.Handler {
+	h := &errHandler{
+		fn:              fn,
+		requestIDHeader: DefaultRequestIDHeader,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// From converts any error into *Error. The cause chain of err is walked from
+// the outside in and the first match is used: a copy of an *Error, or the
+// result of AsError for errors that can describe themselves as *Error (e.g.,
+// ValidationError, Multi). Otherwise, err is wrapped using ErrUnexpected.
+// Returns nil if err is nil.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	for cur := err; cur != nil; cur = stderrors.Unwrap(cur) {
+		switch v := cur.(type) {
+		case *Error:
+			cp := *v
+			cp.Details = make(map[string]interface{}, len(v.Details))
+			for k, val := range v.Details {
+				cp.Details[k] = val
+			}
+			return &cp
+
+		case interface{ AsError() *Error }:
+			return v.AsError()
+		}
+	}
+	return ErrUnexpected(err)
+}
+
+type errHandler struct {
+	fn              HandlerFunc
+	logger          Logger
+	production      bool
+	requestIDHeader string
+}
+
+func (h *errHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqID := r.Header.Get(h.requestIDHeader)
+	if reqID == "" {
+		reqID = newRequestID()
+	}
+	w.Header().Set(h.requestIDHeader, reqID)
+
+	tw := &trackingWriter{ResponseWriter: w}
+	defer func() {
+		if v := recover(); v != nil {
+			if v == http.ErrAbortHandler {
+				// deliberate abort of the response; let net/http handle it.
+				panic(v)
+			}
+
+			h.logf("panic while serving '%s %s' (request_id=%s): %v\n%s",
+				r.Method, r.URL.Path, reqID, v, debug.Stack())
+			h.write(tw, r, reqID, ErrUnexpected(fmt.Errorf("panic: %v", v)))
+		}
+	}()
+
+	if err := h.fn(tw, r); err != nil {
+		e := From(err)
+		if e.Type == "Unknown" {
+			h.logf("unexpected error while serving '%s %s' (request_id=%s): %v",
+				r.Method, r.URL.Path, reqID, err)
+		}
+		h.write(tw, r, reqID, e)
+	}
+}
+
+func (h *errHandler) write(w *trackingWriter, r *http.Request, reqID string, e *Error) {
+	if w.wroteHeader {
+		// response is already (partially) written. nothing we can do.
+		return
+	}
+
+	if h.production {
+		e = sanitize(e)
+	}
+
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details["request_id"] = reqID
+
+	if err := e.WriteFor(w, r); err != nil {
+		h.logf("failed to write error response (request_id=%s): %v", reqID, err)
+	}
+}
+
+// sanitize hides the internal details of unexpected errors including the
+// ones nested in Details["errors"] (e.g., by Multi).
+func sanitize(e *Error) *Error {
+	if e.Type == "Unknown" {
+		return &Error{
+			Code:      http.StatusInternalServerError,
+			Type:      e.Type,
+			ErrorCode: e.ErrorCode,
+			Message:   "An unexpected error occurred",
+			Details:   map[string]interface{}{},
+		}
+	}
+
+	nested, ok := e.Details["errors"].([]*Error)
+	if !ok {
+		return e
+	}
+
+	list := make([]*Error, len(nested))
+	for i, ne := range nested {
+		list[i] = sanitize(ne)
+	}
+
+	cp := *e
+	cp.Details = make(map[string]interface{}, len(e.Details))
+	for k, v := range e.Details {
+		cp.Details[k] = v
+	}
+	cp.Details["errors"] = list
+	return &cp
+}
+
+func (h *errHandler) logf(msg string, args ...interface{}) {
+	if h.logger != nil {
+		h.logger.Errorf(msg, args...)
+	}
+}
+
+// trackingWriter records whether the response has been (partially) written.
+// Flush and Hijack are delegated to the underlying writer if supported so
+// that streaming and websocket handlers keep working.
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (tw *trackingWriter) WriteHeader(code int) {
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+	tw.wroteHeader = true
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *trackingWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		tw.wroteHeader = true
+		f.Flush()
+	}
+}
+
+func (tw *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+
+	tw.wroteHeader = true
+	return hj.Hijack()
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
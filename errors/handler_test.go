@@ -0,0 +1,188 @@
+package errors
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	table := []struct {
+		title   string
+		fn      HandlerFunc
+		opts    []HandlerOption
+		code    int
+		typ     string
+		message string
+	}{
+		{
+			title: "Error",
+			fn: func(w http.ResponseWriter, r *http.Request) error {
+				return ErrResourceNotFound("1", "User")
+			},
+			code: http.StatusNotFound,
+			typ:  "ResourceNotFound",
+		},
+		{
+			title: "UnknownError",
+			fn: func(w http.ResponseWriter, r *http.Request) error {
+				return stderrors.New("db is down")
+			},
+			code:    http.StatusInternalServerError,
+			typ:     "Unknown",
+			message: "db is down",
+		},
+		{
+			title: "Production",
+			fn: func(w http.ResponseWriter, r *http.Request) error {
+				return stderrors.New("db is down")
+			},
+			opts:    []HandlerOption{WithProduction(true)},
+			code:    http.StatusInternalServerError,
+			typ:     "Unknown",
+			message: "An unexpected error occurred",
+		},
+		{
+			title: "Panic",
+			fn: func(w http.ResponseWriter, r *http.Request) error {
+				panic("boom")
+			},
+			code: http.StatusInternalServerError,
+			typ:  "Unknown",
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.title, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(DefaultRequestIDHeader, "req-1")
+
+			Handler(tt.fn, tt.opts...).ServeHTTP(rec, req)
+
+			var got Error
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response body: %v", err)
+			}
+
+			if rec.Code != tt.code || got.Type != tt.typ {
+				t.Errorf("expected %d %s, got %d %s", tt.code, tt.typ, rec.Code, got.Type)
+			}
+			if tt.message != "" && got.Message != tt.message {
+				t.Errorf("expected message '%s', got '%s'", tt.message, got.Message)
+			}
+			if got.Details["request_id"] != "req-1" || rec.Header().Get(DefaultRequestIDHeader) != "req-1" {
+				t.Errorf("expected request id to be echoed, got %v", got.Details["request_id"])
+			}
+		})
+	}
+}
+
+func TestHandler_ProductionNested(t *testing.T) {
+	h := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		return (&Multi{}).Append(
+			ErrMissingParam("name"),
+			stderrors.New("db password=hunter2 rejected"),
+		).Err()
+	}, WithProduction(true))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if body := rec.Body.String(); strings.Contains(body, "hunter2") {
+		t.Fatalf("internal details leaked: %s", body)
+	}
+
+	var got struct {
+		Type    string `json:"type"`
+		Details struct {
+			Errors []Error `json:"errors"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+
+	errs := got.Details.Errors
+	if got.Type != "MultipleErrors" || len(errs) != 2 {
+		t.Fatalf("unexpected response: %s", rec.Body.String())
+	}
+	if errs[0].Type != "MissingParameter" || errs[0].Details["param"] != "name" {
+		t.Errorf("expected known errors to be kept as is, got %#v", errs[0])
+	}
+	if errs[1].Type != "Unknown" || errs[1].Message != "An unexpected error occurred" {
+		t.Errorf("expected nested unknown error to be sanitized, got %#v", errs[1])
+	}
+}
+
+func TestHandler_Flush(t *testing.T) {
+	h := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatalf("expected writer to implement http.Flusher")
+		}
+		f.Flush()
+		return ErrUnexpected(stderrors.New("failed after flush"))
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !rec.Flushed {
+		t.Errorf("expected flush to reach the underlying writer")
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no error body after flush, got '%s'", rec.Body.String())
+	}
+}
+
+func TestHandler_Hijack(t *testing.T) {
+	srv := httptest.NewServer(Handler(func(w http.ResponseWriter, r *http.Request) error {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Errorf("expected writer to implement http.Hijacker")
+			return nil
+		}
+
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		return buf.Flush()
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "hijacked" {
+		t.Errorf("expected hijacked response, got '%s'", body)
+	}
+}
+
+func TestHandler_AbortHandler(t *testing.T) {
+	h := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to be re-panicked, got %v", v)
+		}
+	}()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Errorf("expected ServeHTTP to panic, wrote '%s'", rec.Body.String())
+}
@@ -6,36 +6,40 @@ import (
 
 // ErrConversion can be used to represent conversion errors
 func ErrConversion(err error) *Error {
-	return &Error{
+	return capture(&Error{
 		Code:    1,
 		Type:    "ConversionError",
 		Details: map[string]interface{}{},
 		Message: err.Error(),
-	}
+		cause:   err,
+	})
 }
 
 // ErrConnection is returned when connection fails
 func ErrConnection(err error) *Error {
-	return &Error{
+	return capture(&Error{
 		Code: 1,
 		Type: "ConnectionError",
 		Details: map[string]interface{}{
 			"error": err.Error(),
 		},
 		Message: "Failed to connect to server",
-	}
+		cause:   err,
+	})
 }
 
-// ErrUnexpected represents an unexpected internal error
-// Err field will be populated in this case
+// ErrUnexpected represents an unexpected internal error. The err is retained
+// as the cause and is available through Unwrap.
 func ErrUnexpected(err error) *Error {
 	st := &Error{
-		Code:    http.StatusInternalServerError,
-		Message: err.Error(),
-		Type:    "Unknown",
+		Code:      http.StatusInternalServerError,
+		Message:   err.Error(),
+		Type:      "Unknown",
+		ErrorCode: "unknown",
 		Details: map[string]interface{}{
 			"error": err.Error(),
 		},
+		cause: err,
 	}
-	return st
+	return capture(st)
 }
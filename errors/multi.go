@@ -0,0 +1,111 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Multi aggregates multiple errors into one. Zero value is ready for use.
+type Multi struct {
+	errs []error
+}
+
+// Append adds the non-nil errors to the list. Errors that are themselves
+// *Multi are flattened.
+func (m *Multi) Append(errs ...error) *Multi {
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if nested, ok := err.(*Multi); ok {
+			m.errs = append(m.errs, nested.errs...)
+		} else {
+			m.errs = append(m.errs, err)
+		}
+	}
+	return m
+}
+
+// Errors returns the list of errors collected.
+func (m *Multi) Errors() []error {
+	return append([]error(nil), m.errs...)
+}
+
+// Err returns nil if no errors were collected and the Multi itself otherwise.
+func (m *Multi) Err() error {
+	if m == nil || len(m.errs) == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m *Multi) Error() string {
+	if len(m.errs) == 1 {
+		return m.errs[0].Error()
+	}
+
+	parts := make([]string, 0, len(m.errs))
+	for _, err := range m.errs {
+		parts = append(parts, err.Error())
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(m.errs), strings.Join(parts, "; "))
+}
+
+// Is returns true if any of the collected errors matches the target as per
+// errors.Is.
+func (m *Multi) Is(target error) bool {
+	for _, err := range m.errs {
+		if stderrors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first collected error that matches the target as per
+// errors.As and sets target to it.
+func (m *Multi) As(target interface{}) bool {
+	for _, err := range m.errs {
+		if stderrors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the collected errors. Note that errors.Is and errors.As use
+// this only on Go 1.20+; Is and As above cover the older versions.
+func (m *Multi) Unwrap() []error { return m.errs }
+
+// AsError returns the Error representation. A single error is converted as
+// is using From. For multiple errors, the highest status code among them is
+// used and each error is listed in Details["errors"].
+func (m *Multi) AsError() *Error {
+	if len(m.errs) == 1 {
+		return From(m.errs[0])
+	}
+
+	code := http.StatusBadRequest
+	list := make([]*Error, 0, len(m.errs))
+	for _, err := range m.errs {
+		e := From(err)
+		if e.statusCode() > code {
+			code = e.statusCode()
+		}
+		list = append(list, e)
+	}
+
+	return capture(&Error{
+		Code:      code,
+		Type:      "MultipleErrors",
+		ErrorCode: "multiple_errors",
+		Message:   fmt.Sprintf("%d errors occurred", len(m.errs)),
+		Details: map[string]interface{}{
+			"errors": list,
+		},
+		cause: m,
+	})
+}
@@ -0,0 +1,90 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestMulti(t *testing.T) {
+	var m Multi
+	if m.Err() != nil {
+		t.Errorf("expected nil error for empty Multi")
+	}
+
+	nested := (&Multi{}).Append(io.EOF, nil)
+	m.Append(nil, ErrMissingParam("name"), nested)
+
+	if got := len(m.Errors()); got != 2 {
+		t.Fatalf("expected 2 errors after flattening, got %d", got)
+	}
+
+	want := "2 errors occurred: 400: A value is required for parameter 'name'; EOF"
+	if got := m.Err().Error(); got != want {
+		t.Errorf("expected '%s', got '%s'", want, got)
+	}
+
+	single := (&Multi{}).Append(io.EOF)
+	if got := single.Error(); got != "EOF" {
+		t.Errorf("expected single error message 'EOF', got '%s'", got)
+	}
+}
+
+func TestMulti_IsAs(t *testing.T) {
+	err := fmt.Errorf("sync failed: %w", (&Multi{}).Append(
+		fmt.Errorf("read: %w", io.EOF),
+		ErrResourceNotFound("1", "User"),
+	).Err())
+
+	if !stderrors.Is(err, io.EOF) {
+		t.Errorf("expected errors.Is to find io.EOF")
+	}
+	if !stderrors.Is(err, &Error{Type: "ResourceNotFound"}) {
+		t.Errorf("expected errors.Is to find ResourceNotFound")
+	}
+	if stderrors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected errors.Is to not match os.ErrNotExist")
+	}
+
+	var e *Error
+	if !stderrors.As(err, &e) || e.Type != "ResourceNotFound" {
+		t.Errorf("expected errors.As to find *Error, got %v", e)
+	}
+
+	var pe *os.PathError
+	if stderrors.As(err, &pe) {
+		t.Errorf("expected errors.As to not find *os.PathError")
+	}
+
+	// Is and As are what errors.Is and errors.As rely on before Go 1.20,
+	// which does not understand Unwrap() []error.
+	m := (&Multi{}).Append(fmt.Errorf("read: %w", io.EOF), ErrResourceNotFound("1", "User"))
+	if !m.Is(io.EOF) || m.Is(os.ErrNotExist) {
+		t.Errorf("unexpected result from Multi.Is")
+	}
+
+	var direct *Error
+	if !m.As(&direct) || direct.Type != "ResourceNotFound" {
+		t.Errorf("expected Multi.As to find *Error, got %v", direct)
+	}
+}
+
+func TestMulti_AsError(t *testing.T) {
+	single := From((&Multi{}).Append(ErrMissingParam("name")))
+	if single.Type != "MissingParameter" {
+		t.Errorf("expected single error to be converted as is, got %s", single.Type)
+	}
+
+	e := From((&Multi{}).Append(ErrMissingParam("name"), stderrors.New("db is down")))
+	if e.Type != "MultipleErrors" || e.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 MultipleErrors, got %d %s", e.Code, e.Type)
+	}
+
+	list, ok := e.Details["errors"].([]*Error)
+	if !ok || len(list) != 2 || list[0].Type != "MissingParameter" || list[1].Type != "Unknown" {
+		t.Errorf("unexpected details: %#v", e.Details["errors"])
+	}
+}
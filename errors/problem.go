@@ -0,0 +1,121 @@
+package errors
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeProblem = "application/problem+json"
+	contentTypeText    = "text/plain"
+)
+
+// ProblemTypeBase is prefixed to the Type of the error to form the 'type'
+// member of problem details. For example, setting this to a documentation
+// URL such as "https://example.com/errors/" makes the type resolvable.
+var ProblemTypeBase = ""
+
+// Problem returns the RFC 7807 problem details representation of the error.
+// Type maps to 'type' and 'title', Code to 'status' and Message to 'detail'.
+// Details are added as extension members unless they clash with the standard
+// members. If r is not nil, request path is used as the 'instance'.
+func (e Error) Problem(r *http.Request) map[string]interface{} {
+	p := make(map[string]interface{}, len(e.Details)+5)
+	for k, v := range e.Details {
+		p[k] = v
+	}
+
+	typ := "about:blank"
+	if e.Type != "" {
+		typ = ProblemTypeBase + e.Type
+	}
+	p["type"] = typ
+	p["title"] = titleOf(e.Type, e.statusCode())
+	p["status"] = e.statusCode()
+	if e.ErrorCode != "" {
+		p["error_code"] = e.ErrorCode
+	} else {
+		delete(p, "error_code")
+	}
+	if e.Message != "" {
+		p["detail"] = e.Message
+	} else {
+		delete(p, "detail")
+	}
+
+	if r != nil && r.URL != nil {
+		p["instance"] = r.URL.Path
+	} else {
+		delete(p, "instance")
+	}
+	return p
+}
+
+// titleOf converts the camel-cased type into a human readable title (e.g.,
+// 'ResourceNotFound' to 'Resource Not Found'). Falls back to the HTTP status
+// text if the type is empty.
+func titleOf(typ string, code int) string {
+	if typ == "" {
+		return http.StatusText(code)
+	}
+
+	var sb strings.Builder
+	runes := []rune(typ)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			sb.WriteRune(' ')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// negotiate returns the best supported content-type for the Accept header of
+// the request. Legacy JSON is preferred when the client accepts anything.
+func negotiate(r *http.Request) string {
+	if r == nil {
+		return contentTypeJSON
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return contentTypeJSON
+	}
+
+	best, bestQ := contentTypeJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qs, found := params["q"]; found {
+			if v, err := strconv.ParseFloat(qs, 64); err == nil {
+				q = v
+			}
+		}
+
+		var candidate string
+		switch mediaType {
+		case contentTypeProblem:
+			candidate = contentTypeProblem
+		case contentTypeJSON, "application/*", "*/*":
+			candidate = contentTypeJSON
+		case contentTypeText, "text/*":
+			candidate = contentTypeText
+		default:
+			continue
+		}
+
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,76 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Common codes for field violations.
+const (
+	CodeRequired = "required"
+	CodeEmpty    = "empty"
+	CodeInvalid  = "invalid"
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+)
+
+// FieldViolation describes a problem with the value of one field.
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects violations of multiple fields so that all of them
+// can be reported at once. Zero value is ready for use.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+// Add records a violation for the field.
+func (v *ValidationError) Add(field, code, message string) *ValidationError {
+	v.Violations = append(v.Violations, FieldViolation{
+		Field:   field,
+		Code:    code,
+		Message: message,
+	})
+	return v
+}
+
+// Addf is like Add but formats the message using fmt.Sprintf.
+func (v *ValidationError) Addf(field, code, format string, args ...interface{}) *ValidationError {
+	return v.Add(field, code, fmt.Sprintf(format, args...))
+}
+
+// Err returns nil if there are no violations and the ValidationError itself
+// otherwise. This avoids the nil-interface pitfall when returning it as error.
+func (v *ValidationError) Err() error {
+	if v == nil || len(v.Violations) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v *ValidationError) Error() string {
+	parts := make([]string, 0, len(v.Violations))
+	for _, fv := range v.Violations {
+		parts = append(parts, fmt.Sprintf("%s: %s", fv.Field, fv.Message))
+	}
+	return fmt.Sprintf("validation failed: %s", strings.Join(parts, "; "))
+}
+
+// AsError returns the 400 Error representation of the validation error with
+// the violations in Details["fields"].
+func (v *ValidationError) AsError() *Error {
+	return capture(&Error{
+		Code:      http.StatusBadRequest,
+		Type:      "ValidationFailed",
+		ErrorCode: "validation_failed",
+		Message:   fmt.Sprintf("%d field(s) have invalid values", len(v.Violations)),
+		Details: map[string]interface{}{
+			"fields": append([]FieldViolation(nil), v.Violations...),
+		},
+		cause: v,
+	})
+}
@@ -0,0 +1,73 @@
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidationError(t *testing.T) {
+	var v ValidationError
+	if v.Err() != nil {
+		t.Errorf("expected nil error without violations")
+	}
+
+	v.Add("name", CodeRequired, "name is required").
+		Addf("age", CodeInvalid, "age must be positive, not %d", -1)
+
+	err := v.Err()
+	want := "validation failed: name: name is required; age: age must be positive, not -1"
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected '%s', got '%v'", want, err)
+	}
+
+	e := From(fmt.Errorf("create user: %w", err))
+	if e.Code != http.StatusBadRequest || e.Type != "ValidationFailed" || e.ErrorCode != "validation_failed" {
+		t.Errorf("unexpected error: %#v", e)
+	}
+
+	wantFields := []FieldViolation{
+		{Field: "name", Code: CodeRequired, Message: "name is required"},
+		{Field: "age", Code: CodeInvalid, Message: "age must be positive, not -1"},
+	}
+	if got := e.Details["fields"]; !reflect.DeepEqual(got, wantFields) {
+		t.Errorf("expected fields %#v, got %#v", wantFields, got)
+	}
+}
+
+func TestValidationError_Write(t *testing.T) {
+	var v ValidationError
+	v.Add("email", CodeInvalid, "email is invalid")
+
+	rec := httptest.NewRecorder()
+	if err := v.AsError().Write(rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"fields":[{"field":"email","code":"invalid","message":"email is invalid"}]`) {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestFrom_WrappedValidationError(t *testing.T) {
+	var v ValidationError
+	v.Add("email", CodeInvalid, "email is invalid")
+
+	e := From(fmt.Errorf("save: %w", Wrap(v.Err(), http.StatusConflict, "Conflict", "user already exists")))
+	if e.Code != http.StatusConflict || e.Type != "Conflict" || e.Message != "user already exists" {
+		t.Errorf("expected the outer error to be used, got %d %s '%s'", e.Code, e.Type, e.Message)
+	}
+
+	var m Multi
+	m.Append(v.Err(), ErrMissingParam("name"))
+	e = From(Wrap(m.Err(), http.StatusUnprocessableEntity, "BadBatch", "batch rejected"))
+	if e.Code != http.StatusUnprocessableEntity || e.Type != "BadBatch" {
+		t.Errorf("expected the outer error to be used, got %d %s", e.Code, e.Type)
+	}
+}
@@ -1,48 +1,159 @@
 package errors
 
-// NewWrapper returns an error handling wrapper. If ptrToResult is a pointer
-// to any value, it will be made nil on first error. If a nil-value is passed
-// for ptrToResult, this behaviour will be ignored. If ptrToResult is not a
-// pointer, this function panics.
-func NewWrapper() *Wrapper {
+import (
+	"fmt"
+)
+
+// NewWrapper returns an error handling wrapper that runs a chain of steps.
+// By default, the chain stops at the first error. Use WithCollectAll to run
+// all the steps and collect every error instead.
+func NewWrapper(opts ...WrapperOption) *Wrapper {
 	wr := &Wrapper{}
+	for _, opt := range opts {
+		opt(wr)
+	}
 	return wr
 }
 
+// WrapperOption can be passed to NewWrapper to customise the Wrapper.
+type WrapperOption func(wr *Wrapper)
+
+// WithCollectAll sets whether the steps following a failed step should be
+// run. If enabled, errors from all the steps are returned as *Multi.
+func WithCollectAll(enable bool) WrapperOption {
+	return func(wr *Wrapper) {
+		wr.collectAll = enable
+	}
+}
+
 // Wrapper wraps multiple function calls as a chain of statements while
-// taking care of erros on each function call
+// taking care of errors on each function call.
+//
+//	err := errors.NewWrapper().
+//		Step("open", openFile).
+//		Defer("close", closeFile).
+//		Step("parse", parse).
+//		Return(nil)
 type Wrapper struct {
-	err error
+	collectAll bool
+	halted     bool
+	errs       Multi
+	cleanups   []step
+}
+
+// StepError annotates the error returned by a step with the name of the step.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (se *StepError) Error() string {
+	return fmt.Sprintf("%s: %v", se.Step, se.Err)
+}
+
+// Unwrap returns the error returned by the step.
+func (se *StepError) Unwrap() error { return se.Err }
+
+// Step runs fx if none of the previous steps have failed (or if collect-all
+// is enabled). Error returned by fx is annotated with the step name as a
+// *StepError. Step is a no-op if fx is nil.
+func (wr *Wrapper) Step(name string, fx func() error) *Wrapper {
+	if wr.halted || fx == nil {
+		return wr
+	}
+
+	if err := (step{name: name, fx: fx}).run(); err != nil {
+		wr.errs.Append(err)
+		wr.halted = !wr.collectAll
+	}
+	return wr
+}
+
+// Defer registers fx as a cleanup step which is run only if the chain fails.
+// Cleanup steps are run by Return in the reverse order of registration and
+// are registered only if none of the previous steps have failed, so that a
+// cleanup is attached to the steps that succeeded before it.
+func (wr *Wrapper) Defer(name string, fx func() error) *Wrapper {
+	if fx == nil || len(wr.errs.errs) > 0 {
+		return wr
+	}
+
+	wr.cleanups = append(wr.cleanups, step{name: name, fx: fx})
+	return wr
+}
+
+// Err returns the error collected so far without running cleanup steps.
+// Returns the error as is if only one step failed and *Multi otherwise.
+func (wr *Wrapper) Err() error {
+	if len(wr.errs.errs) == 1 {
+		return wr.errs.errs[0]
+	}
+	return wr.errs.Err()
 }
 
-// Return finalizes the result and returns final error. handler can be
-// used to transform/wrap the actual error with additional context. If
-// nil handler is passed, the actual error will be returned as is.
-// Handler will be called only if there was an error
+// Return finalizes the result and returns final error. If any step failed,
+// the cleanup steps are run and their errors are added to the result.
+// handler can be used to transform/wrap the actual error with additional
+// context. If nil handler is passed, the actual error will be returned as
+// is. Handler will be called only if there was an error.
 func (wr *Wrapper) Return(handler func(error) error) error {
-	if wr.err != nil && handler != nil {
-		wr.err = handler(wr.err)
+	if len(wr.errs.errs) > 0 {
+		wr.runCleanups()
 	}
 
-	return wr.err
+	err := wr.Err()
+	if err != nil && handler != nil {
+		err = handler(err)
+	}
+	return err
 }
 
-// ReturnOnError stops processing the chain further and returns
-// when an error occurs
+// ReturnOnError runs fx if none of the previous steps have failed and stops
+// processing the chain further when fx returns an error, regardless of the
+// collect-all setting. The error is not annotated.
 func (wr *Wrapper) ReturnOnError(fx func() error) *Wrapper {
-	if wr.err != nil {
-		wr.err = fx()
+	if wr.halted || fx == nil {
+		return wr
+	}
+
+	if err := fx(); err != nil {
+		wr.errs.Append(err)
+		wr.halted = true
 	}
 	return wr
 }
 
-// PanicOnError panics when the closure returns error on call
+// PanicOnError runs fx if none of the previous steps have failed and panics
+// with the error when fx returns one. Cleanup steps are run before panic.
 func (wr *Wrapper) PanicOnError(fx func() error) *Wrapper {
-	if wr.err != nil {
-		wr.err = fx()
-		if wr.err != nil {
-			panic(wr.err)
-		}
+	if wr.halted || fx == nil {
+		return wr
+	}
+
+	if err := fx(); err != nil {
+		wr.errs.Append(err)
+		wr.halted = true
+		wr.runCleanups()
+		panic(err)
 	}
 	return wr
 }
+
+func (wr *Wrapper) runCleanups() {
+	for i := len(wr.cleanups) - 1; i >= 0; i-- {
+		wr.errs.Append(wr.cleanups[i].run())
+	}
+	wr.cleanups = nil
+}
+
+type step struct {
+	name string
+	fx   func() error
+}
+
+func (s step) run() error {
+	if err := s.fx(); err != nil {
+		return &StepError{Step: s.name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package errors
+
+import (
+	stderrors "errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestWrapper(t *testing.T) {
+	var calls []string
+	record := func(name string, err error) func() error {
+		return func() error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	err := NewWrapper().
+		Step("open", record("open", nil)).
+		Defer("close", record("close", nil)).
+		Step("read", record("read", io.EOF)).
+		Defer("unused", record("unused", nil)).
+		Step("parse", record("parse", nil)).
+		Return(nil)
+
+	var se *StepError
+	if !stderrors.As(err, &se) || se.Step != "read" || !stderrors.Is(err, io.EOF) {
+		t.Errorf("expected step error for 'read', got %v", err)
+	}
+	if want := []string{"open", "read", "close"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected calls %v, got %v", want, calls)
+	}
+
+	calls = nil
+	err = NewWrapper(WithCollectAll(true)).
+		Step("a", record("a", io.EOF)).
+		Step("b", record("b", nil)).
+		Step("c", record("c", io.ErrUnexpectedEOF)).
+		Return(nil)
+
+	m, ok := err.(*Multi)
+	if !ok || len(m.Errors()) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected calls %v, got %v", want, calls)
+	}
+
+	if err := NewWrapper().ReturnOnError(record("ok", nil)).Return(nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -8,6 +8,8 @@ require (
 	github.com/jhump/protoreflect v1.8.2
 	github.com/mcuadros/go-defaults v1.2.0
 	github.com/slack-go/slack v0.7.4
+	github.com/spf13/cobra v1.4.0
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.11.0
 	github.com/streadway/amqp v1.0.0
 	github.com/stretchr/testify v1.7.1
@@ -0,0 +1,219 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+
+	"github.com/spy16/pkg/worker"
+)
+
+// Stream returns a worker.Stream that emits one Job per kafka message instead
+// of invoking Apply. The Job payload is the *kafka.Message and acking the Job
+// with nil error commits the message offset. Jobs acked with an error are not
+// committed and are logged.
+//
+// Since commits are cumulative per partition, once a job fails no offsets of
+// that partition beyond it are committed (by that consumer) until the failed
+// message is redelivered and succeeds, so that it is not skipped after a
+// restart or a rebalance. This relies on the jobs of a partition being acked
+// in order; use worker.WithKeyFunc with PartitionKey when running multiple
+// workers. Jobs acked after the ctx is cancelled (i.e., after the consumer is
+// closed) are not committed and are logged.
+func (st *Streamer) Stream(buffer int) worker.Stream {
+	return func(ctx context.Context) (<-chan worker.Job, error) {
+		kConf, err := st.init()
+		if err != nil {
+			return nil, err
+		}
+
+		var consumers []*kafka.Consumer
+		for i := 0; i < st.Workers; i++ {
+			con, err := kafka.NewConsumer(kConf)
+			if err != nil {
+				closeAll(consumers)
+				return nil, fmt.Errorf("failed to create consumer: %v", err)
+			}
+			consumers = append(consumers, con)
+
+			if err := con.Subscribe(st.Topic, nil); err != nil {
+				closeAll(consumers)
+				return nil, fmt.Errorf("failed to subscribe to '%s': %v", st.Topic, err)
+			}
+		}
+
+		out := make(chan worker.Job, buffer)
+		done := make(chan struct{}, len(consumers))
+		for i, con := range consumers {
+			go func(id int, con *kafka.Consumer) {
+				defer func() { done <- struct{}{} }()
+
+				if err := st.streamFrom(ctx, id, con, out); err != nil {
+					st.Warnf("consumer %d exited due to error: %v", id, err)
+				}
+			}(i, con)
+		}
+
+		go func() {
+			for range consumers {
+				<-done
+			}
+			close(out)
+		}()
+
+		return out, nil
+	}
+}
+
+// PartitionKey is a worker.KeyFunc that returns the topic-partition of jobs
+// emitted by Streamer.Stream.
+func PartitionKey(job worker.Job) string {
+	if msg, ok := job.Payload.(*kafka.Message); ok {
+		return fmt.Sprintf("%s[%d]", stringOf(msg.TopicPartition.Topic), msg.TopicPartition.Partition)
+	}
+	return ""
+}
+
+func (st *Streamer) streamFrom(ctx context.Context, workerID int, con *kafka.Consumer, out chan<- worker.Job) error {
+	gc := &guardedConsumer{con: con}
+	defer func() { _ = gc.close() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case e, ok := <-con.Events():
+			if !ok {
+				return fmt.Errorf("consumer channel closed")
+			}
+
+			st.handleEvent(workerID, e, con, func(msg *kafka.Message) {
+				select {
+				case <-ctx.Done():
+				case out <- st.toJob(msg, gc):
+				}
+			})
+		}
+	}
+}
+
+func (st *Streamer) toJob(msg *kafka.Message, gc *guardedConsumer) worker.Job {
+	tp := msg.TopicPartition
+	return worker.Job{
+		ID:      fmt.Sprintf("%s[%d]@%s", stringOf(tp.Topic), tp.Partition, tp.Offset),
+		Time:    msg.Timestamp,
+		Payload: msg,
+		Ack: func(err error) {
+			if err != nil {
+				gc.fail(msg)
+				st.Errorf("job failed, not committing (partition=%s): %v", tp, err)
+				return
+			}
+
+			if err := gc.commit(msg); err == errConsumerClosed {
+				st.Warnf("consumer closed, not committing (partition=%s)", tp)
+			} else if err == errPartitionBlocked {
+				st.Warnf("earlier message failed, not committing (partition=%s)", tp)
+			} else if err != nil {
+				st.Warnf("failed to commit offset (partition=%s): %v", tp, err)
+			}
+		},
+	}
+}
+
+var (
+	errConsumerClosed   = errors.New("consumer closed")
+	errPartitionBlocked = errors.New("partition has an uncommitted failure")
+)
+
+// committer is the part of *kafka.Consumer used by guardedConsumer.
+type committer interface {
+	CommitMessage(msg *kafka.Message) ([]kafka.TopicPartition, error)
+	Close() error
+}
+
+type partitionID struct {
+	topic     string
+	partition int32
+}
+
+// guardedConsumer serialises commits with closing the consumer since jobs
+// can be acked after the consumer is closed and using a closed consumer is
+// not safe. It also tracks the first failed offset of each partition so that
+// commits do not move past it.
+type guardedConsumer struct {
+	mu     sync.Mutex
+	con    committer
+	closed bool
+	failed map[partitionID]kafka.Offset
+}
+
+func (gc *guardedConsumer) commit(msg *kafka.Message) error {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.closed {
+		return errConsumerClosed
+	}
+
+	pid := partitionOf(msg)
+	if failedAt, found := gc.failed[pid]; found {
+		if msg.TopicPartition.Offset != failedAt {
+			return errPartitionBlocked
+		}
+		// the failed message succeeded on redelivery.
+		delete(gc.failed, pid)
+	}
+
+	_, err := gc.con.CommitMessage(msg)
+	return err
+}
+
+func (gc *guardedConsumer) fail(msg *kafka.Message) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.failed == nil {
+		gc.failed = map[partitionID]kafka.Offset{}
+	}
+
+	pid := partitionOf(msg)
+	if failedAt, found := gc.failed[pid]; !found || msg.TopicPartition.Offset < failedAt {
+		gc.failed[pid] = msg.TopicPartition.Offset
+	}
+}
+
+func (gc *guardedConsumer) close() error {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.closed {
+		return nil
+	}
+	gc.closed = true
+	return gc.con.Close()
+}
+
+func partitionOf(msg *kafka.Message) partitionID {
+	return partitionID{
+		topic:     stringOf(msg.TopicPartition.Topic),
+		partition: msg.TopicPartition.Partition,
+	}
+}
+
+func stringOf(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func closeAll(consumers []*kafka.Consumer) {
+	for _, con := range consumers {
+		_ = con.Close()
+	}
+}
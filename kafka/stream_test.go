@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+
+	"github.com/spy16/pkg/log"
+)
+
+func TestStream_FailedOffsetNotSkipped(t *testing.T) {
+	st := &Streamer{Logger: log.NoOpLogger{}}
+	fc := &fakeCommitter{}
+	gc := &guardedConsumer{con: fc}
+
+	topic := "events"
+	msg := func(partition int32, offset kafka.Offset) *kafka.Message {
+		return &kafka.Message{TopicPartition: kafka.TopicPartition{
+			Topic: &topic, Partition: partition, Offset: offset,
+		}}
+	}
+
+	st.toJob(msg(0, 10), gc).Ack(nil)
+	st.toJob(msg(0, 11), gc).Ack(errors.New("failed"))
+	st.toJob(msg(0, 12), gc).Ack(nil)
+	st.toJob(msg(1, 5), gc).Ack(nil)
+	assert.Equal(t, []kafka.Offset{10, 5}, fc.offsets,
+		"offsets beyond the failed one must not be committed on the same partition")
+
+	// redelivered failed message succeeds.
+	st.toJob(msg(0, 11), gc).Ack(nil)
+	st.toJob(msg(0, 12), gc).Ack(nil)
+	assert.Equal(t, []kafka.Offset{10, 5, 11, 12}, fc.offsets)
+
+	assert.NoError(t, gc.close())
+	st.toJob(msg(0, 13), gc).Ack(nil)
+	assert.Equal(t, []kafka.Offset{10, 5, 11, 12}, fc.offsets, "acks after close must not commit")
+	assert.Equal(t, 1, fc.closed)
+}
+
+type fakeCommitter struct {
+	offsets []kafka.Offset
+	closed  int
+}
+
+func (fc *fakeCommitter) CommitMessage(msg *kafka.Message) ([]kafka.TopicPartition, error) {
+	fc.offsets = append(fc.offsets, msg.TopicPartition.Offset)
+	return nil, nil
+}
+
+func (fc *fakeCommitter) Close() error {
+	fc.closed++
+	return nil
+}
@@ -73,7 +73,9 @@ func (st *Streamer) runWorker(ctx context.Context, workerID int, con *kafka.Cons
 			if !ok {
 				return fmt.Errorf("consumer channel closed")
 			}
-			st.handleEvent(ctx, workerID, e, con)
+			st.handleEvent(workerID, e, con, func(msg *kafka.Message) {
+				st.apply(ctx, msg, con)
+			})
 		}
 	}
 }
@@ -95,7 +97,7 @@ func (st *Streamer) init() (*kafka.ConfigMap, error) {
 	}, nil
 }
 
-func (st *Streamer) handleEvent(ctx context.Context, workerID int, ev kafka.Event, con *kafka.Consumer) {
+func (st *Streamer) handleEvent(workerID int, ev kafka.Event, con *kafka.Consumer, onMessage func(msg *kafka.Message)) {
 	switch e := ev.(type) {
 	case kafka.AssignedPartitions:
 		_ = con.Assign(e.Partitions)
@@ -106,11 +108,7 @@ func (st *Streamer) handleEvent(ctx context.Context, workerID int, ev kafka.Even
 		st.Debugf("partition %s revoked from %d", e.Partitions, workerID)
 
 	case *kafka.Message:
-		if err := st.Apply(ctx, e.Key, e.Value); err != nil {
-			st.Errorf("apply failed (partition=%s): %v", e.TopicPartition, err)
-			return
-		}
-		_, _ = con.CommitMessage(e)
+		onMessage(e)
 
 	case kafka.PartitionEOF:
 		st.Infof("reached EOF of partition=%s", e)
@@ -119,3 +117,11 @@ func (st *Streamer) handleEvent(ctx context.Context, workerID int, ev kafka.Even
 		st.Warnf("got error from kafka: %v", e)
 	}
 }
+
+func (st *Streamer) apply(ctx context.Context, msg *kafka.Message, con *kafka.Consumer) {
+	if err := st.Apply(ctx, msg.Key, msg.Value); err != nil {
+		st.Errorf("apply failed (partition=%s): %v", msg.TopicPartition, err)
+		return
+	}
+	_, _ = con.CommitMessage(msg)
+}
@@ -0,0 +1,101 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/streadway/amqp"
+
+	"github.com/spy16/pkg/worker"
+)
+
+// Stream returns a worker.Stream that emits one Job per AMQP delivery instead
+// of invoking Process. The Job payload is the amqp.Delivery. Unless AutoAck
+// is set, acking the Job with nil error acks the delivery and acking with an
+// error nacks it with requeue. The connection is closed when the ctx is done
+// and any deliveries that were not acked by then are redelivered by the
+// broker.
+func (st *Streamer) Stream(buffer int) worker.Stream {
+	return func(ctx context.Context) (<-chan worker.Job, error) {
+		if err := st.init(); err != nil {
+			return nil, err
+		}
+
+		conn, err := amqp.Dial(st.Addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ch, err := conn.Channel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		msgCh, err := ch.Consume(st.Queue, st.Consumer, st.AutoAck,
+			false, false, false, nil)
+		if err != nil {
+			_ = ch.Close()
+			_ = conn.Close()
+			return nil, err
+		}
+
+		out := make(chan worker.Job, buffer)
+		go func() {
+			defer close(out)
+			defer func() {
+				_ = ch.Close()
+				_ = conn.Close()
+			}()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+
+				case d, more := <-msgCh:
+					if !more {
+						return
+					}
+
+					select {
+					case <-ctx.Done():
+						return
+					case out <- st.toJob(d):
+					}
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+func (st *Streamer) toJob(d amqp.Delivery) worker.Job {
+	id := d.MessageId
+	if id == "" {
+		id = fmt.Sprintf("%s#%d", st.Queue, d.DeliveryTag)
+	}
+
+	job := worker.Job{
+		ID:      id,
+		Time:    d.Timestamp,
+		Payload: d,
+		Ack: func(err error) {
+			if st.AutoAck {
+				return
+			}
+
+			if err != nil {
+				_ = d.Nack(false, true)
+			} else {
+				_ = d.Ack(false)
+			}
+		},
+	}
+
+	if d.Redelivered {
+		job.Attempt = 1
+	}
+	return job
+}
@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// AutoScaler can be passed to WithAutoScaler() to let the worker session grow
+// and shrink the number of workers based on the stream backlog and the job
+// latency. An AutoScaler must not be shared between sessions.
+type AutoScaler struct {
+	size int64 // accessed atomically. must be first for 64-bit alignment.
+
+	Min int // minimum number of workers (defaults to 1).
+	Max int // maximum number of workers (defaults to Min).
+
+	// Interval is the period at which the backlog and latency are evaluated.
+	// Defaults to 1 second.
+	Interval time.Duration
+
+	// Cooldown is the idle duration after which a worker beyond Min retires.
+	// Defaults to 30 seconds.
+	Cooldown time.Duration
+
+	// BacklogThreshold is the number of jobs buffered in the stream beyond
+	// which workers are added. If zero, the current worker count is used.
+	BacklogThreshold int
+
+	// LatencyThreshold is the average job latency beyond which workers are
+	// added. If zero, latency is not considered.
+	LatencyThreshold time.Duration
+
+	// OnResize, if set, is invoked with the new worker count every time the
+	// pool grows or shrinks.
+	OnResize func(size int)
+}
+
+// Size returns the current number of workers in the pool.
+func (as *AutoScaler) Size() int { return int(atomic.LoadInt64(&as.size)) }
+
+// scaler is the session-owned state of an AutoScaler. cfg is a copy of the
+// AutoScaler with the defaults applied so that the caller's value is never
+// modified. Only the pool size is reported back through the AutoScaler.
+type scaler struct {
+	latencySum   int64 // accessed atomically. must be first for 64-bit alignment.
+	latencyCount int64
+	cfg          AutoScaler
+	pub          *AutoScaler
+}
+
+func newScaler(as *AutoScaler) *scaler {
+	cfg := AutoScaler{
+		Min:              as.Min,
+		Max:              as.Max,
+		Interval:         as.Interval,
+		Cooldown:         as.Cooldown,
+		BacklogThreshold: as.BacklogThreshold,
+		LatencyThreshold: as.LatencyThreshold,
+		OnResize:         as.OnResize,
+	}
+	if cfg.Min <= 0 {
+		cfg.Min = 1
+	}
+	if cfg.Max < cfg.Min {
+		cfg.Max = cfg.Min
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	atomic.StoreInt64(&as.size, 0)
+	return &scaler{cfg: cfg, pub: as}
+}
+
+func (sc *scaler) size() int { return sc.pub.Size() }
+
+func (sc *scaler) observe(latency time.Duration) {
+	atomic.AddInt64(&sc.latencySum, int64(latency))
+	atomic.AddInt64(&sc.latencyCount, 1)
+}
+
+// scaleBy returns the number of workers to be added given the current
+// backlog and the latencies observed since the last call.
+func (sc *scaler) scaleBy(backlog int) int {
+	sum := atomic.SwapInt64(&sc.latencySum, 0)
+	count := atomic.SwapInt64(&sc.latencyCount, 0)
+
+	size := sc.size()
+	if size >= sc.cfg.Max {
+		return 0
+	}
+
+	threshold := sc.cfg.BacklogThreshold
+	if threshold <= 0 {
+		threshold = size
+	}
+
+	overloaded := backlog > threshold
+	if sc.cfg.LatencyThreshold > 0 && count > 0 {
+		overloaded = overloaded || time.Duration(sum/count) > sc.cfg.LatencyThreshold
+	}
+	if !overloaded {
+		return 0
+	}
+
+	// grow geometrically to catch up with bursts quickly.
+	n := size
+	if n < 1 {
+		n = 1
+	}
+	if size+n > sc.cfg.Max {
+		n = sc.cfg.Max - size
+	}
+	return n
+}
+
+// grew must be called for every worker added to the pool.
+func (sc *scaler) grew() {
+	sc.resized(atomic.AddInt64(&sc.pub.size, 1))
+}
+
+// shrunk must be called for every worker that exits without retiring.
+func (sc *scaler) shrunk() {
+	sc.resized(atomic.AddInt64(&sc.pub.size, -1))
+}
+
+// tryRetire shrinks the pool by one if it is above Min and returns true if
+// the calling worker should exit.
+func (sc *scaler) tryRetire() bool {
+	for {
+		size := atomic.LoadInt64(&sc.pub.size)
+		if size <= int64(sc.cfg.Min) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&sc.pub.size, size, size-1) {
+			sc.resized(size - 1)
+			return true
+		}
+	}
+}
+
+func (sc *scaler) resized(size int64) {
+	if sc.cfg.OnResize != nil {
+		sc.cfg.OnResize(int(size))
+	}
+}
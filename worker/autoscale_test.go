@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spy16/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoScaler(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	as := &AutoScaler{
+		Min:      1,
+		Max:      4,
+		Interval: 5 * time.Millisecond,
+		Cooldown: 30 * time.Millisecond,
+		OnResize: func(size int) {
+			mu.Lock()
+			defer mu.Unlock()
+			sizes = append(sizes, size)
+		},
+	}
+
+	stream := make(chan Job, 40)
+	for i := 0; i < 40; i++ {
+		stream <- Job{ID: "job"}
+	}
+
+	proc := ProcFn(func(_ context.Context, _ Job) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan Summary)
+	go func() {
+		summary, err := Run(ctx, stream, WithProc(proc, 1),
+			WithLogger(log.NoOpLogger{}), WithAutoScaler(as))
+		assert.NoError(t, err)
+		done <- summary
+	}()
+
+	require.Eventually(t, func() bool { return as.Size() == as.Max }, time.Second, time.Millisecond,
+		"expected pool to grow to max")
+	require.Eventually(t, func() bool { return len(stream) == 0 && as.Size() == as.Min }, time.Second, time.Millisecond,
+		"expected idle workers to retire")
+
+	cancel()
+	select {
+	case summary := <-done:
+		assert.Equal(t, 40, summary.Processed)
+	case <-time.After(time.Second):
+		t.Fatal("session did not stop")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 0, as.Size())
+	assert.Equal(t, 0, sizes[len(sizes)-1])
+}
+
+func TestAutoScaler_ConfigUntouched(t *testing.T) {
+	as := &AutoScaler{Max: -1}
+
+	stream := make(chan Job)
+	close(stream)
+
+	_, err := Run(context.Background(), stream, WithLogger(log.NoOpLogger{}), WithAutoScaler(as))
+	require.NoError(t, err)
+	assert.Equal(t, AutoScaler{Max: -1}, *as, "defaults must not be written into the caller's value")
+}
@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// BatchProc represents the processor to be applied on a batch of jobs. The
+// returned slice must have one entry per job (in the same order) with the
+// result of that job. A nil slice means all the jobs succeeded.
+type BatchProc interface {
+	ExecBatch(ctx context.Context, jobs []Job) []error
+}
+
+// BatchProcFn is an adaptor type to implement BatchProc using Go func values.
+type BatchProcFn func(ctx context.Context, jobs []Job) []error
+
+func (bFn BatchProcFn) ExecBatch(ctx context.Context, jobs []Job) []error { return bFn(ctx, jobs) }
+
+// batchWorker accumulates the jobs from the stream into batches of up to
+// batchSize jobs or whatever is accumulated within batchWait of the first
+// job and executes them using the batch proc.
+func (ws *workerSession) batchWorker(ctx, jobCtx context.Context, ch <-chan Job) error {
+	for {
+		var first Job
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case j, ok := <-ch:
+			if !ok {
+				ws.streamClosed()
+				return errors.New("stream closed")
+			}
+
+			if ws.drain && ctx.Err() != nil {
+				ws.drainOne(j)
+				return ctx.Err()
+			}
+			first = j
+		}
+
+		batch, err := ws.accumulate(ctx, ch, first)
+		ws.processBatch(jobCtx, batch)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// accumulate collects jobs into the batch until it is full or the batch wait
+// elapses. Returns error if the stream is closed or ctx is cancelled, along
+// with the jobs accumulated so far.
+func (ws *workerSession) accumulate(ctx context.Context, ch <-chan Job, first Job) ([]Job, error) {
+	batch := make([]Job, 0, ws.batchSize)
+	batch = append(batch, first)
+
+	timer := time.NewTimer(ws.batchWait)
+	defer timer.Stop()
+
+	for len(batch) < ws.batchSize {
+		select {
+		case <-ctx.Done():
+			return batch, ctx.Err()
+
+		case <-timer.C:
+			return batch, nil
+
+		case j, ok := <-ch:
+			if !ok {
+				ws.streamClosed()
+				return batch, errors.New("stream closed")
+			}
+
+			if ws.drain && ctx.Err() != nil {
+				ws.drainOne(j)
+				return batch, ctx.Err()
+			}
+			batch = append(batch, j)
+		}
+	}
+	return batch, nil
+}
+
+// processBatch executes the batch and acks every job with its own result.
+// Jobs whose own context (see Job.ctx) is already cancelled are acked with
+// the context error and left out of the batch. Cancellation of a job after
+// the batch has started is not propagated, since the batch shares a single
+// context.
+func (ws *workerSession) processBatch(ctx context.Context, batch []Job) {
+	batch = ws.skipCancelled(batch)
+	if len(batch) == 0 {
+		return
+	}
+
+	if ws.jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.jobTimeout)
+		defer cancel()
+	}
+
+	stopWatches := make([]func(), len(batch))
+	for i, job := range batch {
+		var lag time.Duration
+		if !job.Time.IsZero() {
+			lag = time.Since(job.Time)
+		}
+		ws.metrics.JobStarted(job, lag)
+		stopWatches[i] = ws.watch(job)
+	}
+
+	atomic.AddInt64(&ws.stats.inFlight, int64(len(batch)))
+	start := time.Now()
+	errs := ws.execBatch(ctx, batch)
+	atomic.AddInt64(&ws.stats.inFlight, -int64(len(batch)))
+	latency := time.Since(start)
+
+	for i, job := range batch {
+		stopWatches[i]()
+		ws.metrics.JobFinished(job, latency, errs[i])
+		ws.finish(job, errs[i])
+	}
+}
+
+func (ws *workerSession) skipCancelled(batch []Job) []Job {
+	live := batch[:0]
+	for _, job := range batch {
+		if job.ctx != nil && job.ctx.Err() != nil {
+			ws.reject(job, job.ctx.Err())
+			continue
+		}
+		live = append(live, job)
+	}
+	return live
+}
+
+// execBatch invokes the batch proc and normalises the result to one error per
+// job. A panic or a result of incorrect length fails the entire batch.
+func (ws *workerSession) execBatch(ctx context.Context, batch []Job) (errs []error) {
+	defer func() {
+		if v := recover(); v != nil {
+			pe := &PanicError{Value: v, Stack: debug.Stack()}
+			ws.Errorf("batch proc panicked on batch of %d jobs: %v\n%s", len(batch), v, pe.Stack)
+			errs = batchError(len(batch), pe)
+		}
+	}()
+
+	errs = ws.batchProc.ExecBatch(ctx, batch)
+	if errs == nil {
+		return make([]error, len(batch))
+	} else if len(errs) != len(batch) {
+		err := fmt.Errorf("batch proc returned %d results for %d jobs", len(errs), len(batch))
+		ws.Errorf("%v", err)
+		return batchError(len(batch), err)
+	}
+	return errs
+}
+
+func batchError(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spy16/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_BatchSize(t *testing.T) {
+	rec := &batchRecord{}
+
+	jobs, _ := ackedJobs("1", "2", "3", "4", "5", "6", "7")
+	summary, err := Run(context.Background(), jobs, WithLogger(log.NoOpLogger{}),
+		WithBatchProc(rec, 3, time.Second, 1))
+	require.NoError(t, err)
+	assert.Equal(t, 7, summary.Processed)
+	assert.Equal(t, [][]string{{"1", "2", "3"}, {"4", "5", "6"}, {"7"}}, rec.get())
+}
+
+func TestRun_BatchWait(t *testing.T) {
+	rec := &batchRecord{}
+	acks := &ackRecord{errs: map[string]error{}}
+
+	jobs := make(chan Job)
+	go func() {
+		jobs <- acks.job("1")
+		jobs <- acks.job("2")
+		time.Sleep(100 * time.Millisecond)
+		jobs <- acks.job("3")
+		close(jobs)
+	}()
+
+	begin := time.Now()
+	_, err := Run(context.Background(), jobs, WithLogger(log.NoOpLogger{}),
+		WithBatchProc(rec, 10, 20*time.Millisecond, 1))
+	require.NoError(t, err)
+	assert.True(t, time.Since(begin) < time.Second, "took %s", time.Since(begin))
+	assert.Equal(t, [][]string{{"1", "2"}, {"3"}}, rec.get())
+}
+
+func TestRun_BatchAcks(t *testing.T) {
+	errBad := errors.New("bad job")
+
+	t.Run("PerJob", func(t *testing.T) {
+		proc := BatchProcFn(func(_ context.Context, jobs []Job) []error {
+			errs := make([]error, len(jobs))
+			for i, job := range jobs {
+				if job.ID == "bad" {
+					errs[i] = errBad
+				}
+			}
+			return errs
+		})
+
+		jobs, acks := ackedJobs("good", "bad", "other")
+		summary, err := Run(context.Background(), jobs, WithLogger(log.NoOpLogger{}),
+			WithBatchProc(proc, 3, time.Second, 1))
+		require.NoError(t, err)
+		assert.Equal(t, Summary{Processed: 3, Failed: 1}, summary)
+		assert.NoError(t, acks.get("good"))
+		assert.Equal(t, errBad, acks.get("bad"))
+		assert.NoError(t, acks.get("other"))
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		proc := BatchProcFn(func(_ context.Context, _ []Job) []error { panic("boom") })
+
+		jobs, acks := ackedJobs("a", "b")
+		_, err := Run(context.Background(), jobs, WithLogger(log.NoOpLogger{}),
+			WithBatchProc(proc, 2, time.Second, 1))
+		require.NoError(t, err)
+
+		var pe *PanicError
+		assert.True(t, errors.As(acks.get("a"), &pe))
+		assert.True(t, errors.As(acks.get("b"), &pe))
+	})
+
+	t.Run("WrongLength", func(t *testing.T) {
+		proc := BatchProcFn(func(_ context.Context, _ []Job) []error { return []error{nil} })
+
+		jobs, acks := ackedJobs("a", "b")
+		summary, err := Run(context.Background(), jobs, WithLogger(log.NoOpLogger{}),
+			WithBatchProc(proc, 2, time.Second, 1))
+		require.NoError(t, err)
+		assert.Equal(t, Summary{Processed: 2, Failed: 2}, summary)
+		assert.Error(t, acks.get("a"))
+		assert.Error(t, acks.get("b"))
+	})
+}
+
+func TestRun_BatchCancelledJob(t *testing.T) {
+	rec := &batchRecord{}
+	acks := &ackRecord{errs: map[string]error{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := acks.job("cancelled")
+	cancelled.ctx = ctx
+
+	jobs := make(chan Job, 2)
+	jobs <- acks.job("live")
+	jobs <- cancelled
+	close(jobs)
+
+	summary, err := Run(context.Background(), jobs, WithLogger(log.NoOpLogger{}),
+		WithBatchProc(rec, 2, time.Second, 1))
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Processed: 1, Rejected: 1}, summary)
+	assert.Equal(t, [][]string{{"live"}}, rec.get())
+	assert.NoError(t, acks.get("live"))
+	assert.Equal(t, context.Canceled, acks.get("cancelled"))
+}
+
+func TestRun_BatchWithMiddleware(t *testing.T) {
+	jobs, _ := ackedJobs()
+	_, err := Run(context.Background(), jobs, WithBatchProc(&batchRecord{}, 2, time.Second, 1),
+		WithMiddleware(Logging(log.NoOpLogger{})))
+	assert.Error(t, err)
+}
+
+// batchRecord is a BatchProc that records the IDs of the jobs in each batch.
+type batchRecord struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (br *batchRecord) ExecBatch(_ context.Context, jobs []Job) []error {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.batches = append(br.batches, ids)
+	return nil
+}
+
+func (br *batchRecord) get() [][]string {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.batches
+}
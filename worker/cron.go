@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes the activation times for a scheduled job.
+type Schedule interface {
+	// Next returns the first activation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// Every returns a Schedule that activates at fixed intervals. Intervals are
+// rounded to seconds and must be at least 1 second.
+func Every(interval time.Duration) Schedule {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return everySchedule(interval.Round(time.Second))
+}
+
+// ParseCron parses the standard 5-field cron expression (minute, hour,
+// day-of-month, month, day-of-week) and returns the Schedule. Fields support
+// '*', lists (1,2), ranges (1-5), steps (*/15, 1-30/5) and names for months
+// (jan-dec) and week-days (sun-sat). Descriptors @yearly (@annually),
+// @monthly, @weekly, @daily (@midnight), @hourly and '@every <duration>' are
+// also supported. The schedule is evaluated in the location of the time
+// passed to Next.
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@") {
+		return parseDescriptor(spec)
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields, found %d in '%s'", len(fields), spec)
+	}
+
+	var cs cronSchedule
+	var err error
+	if cs.minute, err = parseField(fields[0], cronBounds[0]); err != nil {
+		return nil, err
+	}
+	if cs.hour, err = parseField(fields[1], cronBounds[1]); err != nil {
+		return nil, err
+	}
+	if cs.dom, err = parseField(fields[2], cronBounds[2]); err != nil {
+		return nil, err
+	}
+	if cs.month, err = parseField(fields[3], cronBounds[3]); err != nil {
+		return nil, err
+	}
+	if cs.dow, err = parseField(fields[4], cronBounds[4]); err != nil {
+		return nil, err
+	}
+	// 7 is an alias for sunday.
+	if cs.dow&(1<<7) != 0 {
+		cs.dow |= 1
+	}
+	cs.domStar = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	cs.dowStar = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+
+	return cs, nil
+}
+
+type everySchedule time.Duration
+
+func (es everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(es)).Truncate(time.Second)
+}
+
+// cronSchedule holds the allowed values of each field as bit-sets.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+func (cs cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+
+	// no valid time within 5 years means the spec can never match (e.g.,
+	// 30th of February).
+	yearLimit := t.Year() + 5
+
+wrap:
+	for t.Year() <= yearLimit {
+		for cs.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			if t.Month() == time.January {
+				continue wrap
+			}
+		}
+
+		for !cs.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			if t.Day() == 1 {
+				continue wrap
+			}
+		}
+
+		for cs.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if t.Hour() == 0 {
+				continue wrap
+			}
+		}
+
+		for cs.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			if t.Minute() == 0 {
+				continue wrap
+			}
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches follows the cron convention: if both day-of-month and day-of-week
+// are restricted, the day matches if either of them matches.
+func (cs cronSchedule) dayMatches(t time.Time) bool {
+	domOK := cs.dom&(1<<uint(t.Day())) != 0
+	dowOK := cs.dow&(1<<uint(t.Weekday())) != 0
+	if cs.domStar || cs.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var cronBounds = [5]bounds{
+	{min: 0, max: 59},
+	{min: 0, max: 23},
+	{min: 1, max: 31},
+	{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("cron: invalid step in '%s'", part)
+			}
+			rangePart, step = part[:i], s
+		}
+
+		lo, hi := b.min, b.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], b); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseValue(bounds[1], b); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// 'n/step' means from n to max.
+				hi = b.max
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("cron: invalid range '%s'", rangePart)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, b bounds) (int, error) {
+	if v, found := b.names[strings.ToLower(s)]; found {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid value '%s'", s)
+	} else if v < b.min || v > b.max {
+		return 0, fmt.Errorf("cron: value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+func parseDescriptor(spec string) (Schedule, error) {
+	switch spec {
+	case "@yearly", "@annually":
+		return ParseCron("0 0 1 1 *")
+	case "@monthly":
+		return ParseCron("0 0 1 * *")
+	case "@weekly":
+		return ParseCron("0 0 * * 0")
+	case "@daily", "@midnight":
+		return ParseCron("0 0 * * *")
+	case "@hourly":
+		return ParseCron("0 * * * *")
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("cron: invalid duration in '%s': %v", spec, err)
+		}
+		return Every(d), nil
+	}
+
+	return nil, fmt.Errorf("cron: unknown descriptor '%s'", spec)
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2021, time.January, 30, 10, 15, 30, 0, time.UTC)
+
+	table := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2021, 1, 30, 10, 16, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2021, 1, 30, 10, 20, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2021, 1, 30, 11, 5, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2021, 1, 30, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * mon", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * sun", time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"30 2 1,15 * *", time.Date(2021, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2021, 1, 30, 10, 17, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.spec, func(t *testing.T) {
+			sched, err := ParseCron(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sched.Next(base))
+		})
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * foo *", "5-1 * * * *", "*/0 * * * *", "@often", "@every x"} {
+		_, err := ParseCron(spec)
+		assert.Error(t, err, spec)
+	}
+
+	sched, err := ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, sched.Next(base).IsZero())
+}
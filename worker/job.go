@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -13,7 +14,12 @@ type Job struct {
 	Ack     func(err error) // acknowledge callback when message is processed.
 	Time    time.Time       // time at which this job was created.
 	Error   error           // error during processing if any.
+	Attempt int             // number of earlier delivery attempts (0 for first).
 	Payload interface{}     // payload of the message.
+
+	// ctx, if set, is merged into the context passed to the proc so that
+	// the producer of the job can cancel its execution.
+	ctx context.Context
 }
 
 // EnsureValid sets defaults for unset fields where possible and validates the
@@ -40,3 +46,12 @@ func (j Job) String() string {
 
 	return fmt.Sprintf("Job{%s}", strings.Join(parts, ", "))
 }
+
+// PanicError is used as the job error when the Proc panics while processing
+// a job. Stack contains the stack trace captured at the time of recovery.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (pe PanicError) Error() string { return fmt.Sprintf("panic: %v", pe.Value) }
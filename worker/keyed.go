@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// laneBuffer is the number of jobs that can be queued for each worker lane
+// in keyed ordering mode before the partitioner blocks.
+const laneBuffer = 16
+
+// KeyFunc returns the ordering key for the job. Jobs with the same key are
+// executed serially in the order of their arrival.
+type KeyFunc func(job Job) string
+
+// partition starts a goroutine that routes the jobs from the stream to one
+// lane per worker based on the hash of the job key. Lanes are closed once the
+// stream is closed or ctx is cancelled.
+func (ws *workerSession) partition(ctx context.Context, stream <-chan Job, wg *sync.WaitGroup) []chan Job {
+	lanes := make([]chan Job, ws.workers)
+	for i := range lanes {
+		lanes[i] = make(chan Job, laneBuffer)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			for _, lane := range lanes {
+				close(lane)
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case j, ok := <-stream:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					if ws.drain {
+						ws.drainOne(j)
+					}
+					return
+
+				case lanes[laneOf(ws.keyFn(j), len(lanes))] <- j:
+				}
+			}
+		}
+	}()
+
+	return lanes
+}
+
+func laneOf(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spy16/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_KeyedOrdering(t *testing.T) {
+	const workers = 4
+	keyA, keyB := "a", "b"
+	for i := 0; laneOf(keyA, workers) == laneOf(keyB, workers); i++ {
+		keyB = fmt.Sprintf("b%d", i)
+	}
+
+	type task struct {
+		key string
+		seq int
+	}
+
+	stream := make(chan Job, 20)
+	for i := 0; i < 10; i++ {
+		stream <- Job{ID: fmt.Sprintf("%s-%d", keyA, i), Payload: task{key: keyA, seq: i}}
+		stream <- Job{ID: fmt.Sprintf("%s-%d", keyB, i), Payload: task{key: keyB, seq: i}}
+	}
+	close(stream)
+
+	var mu sync.Mutex
+	active := map[string]int{}
+	order := map[string][]int{}
+	started := map[string]chan struct{}{keyA: make(chan struct{}), keyB: make(chan struct{})}
+
+	proc := ProcFn(func(_ context.Context, job Job) error {
+		tk := job.Payload.(task)
+
+		mu.Lock()
+		active[tk.key]++
+		assert.Equal(t, 1, active[tk.key], "jobs with key '%s' ran concurrently", tk.key)
+		order[tk.key] = append(order[tk.key], tk.seq)
+		mu.Unlock()
+
+		if tk.seq == 0 {
+			// first jobs of both keys must be running at the same time.
+			close(started[tk.key])
+			other := keyA
+			if tk.key == keyA {
+				other = keyB
+			}
+			select {
+			case <-started[other]:
+			case <-time.After(time.Second):
+				t.Errorf("jobs with key '%s' and '%s' did not run in parallel", keyA, keyB)
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		active[tk.key]--
+		mu.Unlock()
+		return nil
+	})
+
+	summary, err := Run(context.Background(), stream, WithProc(proc, workers),
+		WithLogger(log.NoOpLogger{}), WithKeyFunc(func(job Job) string {
+			return job.Payload.(task).key
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, 20, summary.Processed)
+
+	want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	assert.Equal(t, want, order[keyA])
+	assert.Equal(t, want, order[keyB])
+}
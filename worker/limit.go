@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter delays or blocks the execution of jobs. acquire must block until
+// the job is allowed to run or ctx is cancelled and the returned release func
+// must be called once the job finishes.
+type limiter interface {
+	name() string
+	acquire(ctx context.Context, job Job) (release func(), err error)
+}
+
+// acquire acquires all the configured limiters for the job in order. Time
+// spent waiting on each limiter is reported to the metrics.
+func (ws *workerSession) acquire(ctx context.Context, job Job) (func(), error) {
+	var releases []func()
+	releaseAll := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	for _, l := range ws.limiters {
+		start := time.Now()
+		release, err := l.acquire(ctx, job)
+		ws.metrics.LimiterWaited(job, l.name(), time.Since(start))
+		if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	return releaseAll, nil
+}
+
+// bucketSweepInterval is the minimum interval between the sweeps that evict
+// idle buckets of keyed rate limiters.
+const bucketSweepInterval = time.Minute
+
+// rateLimiter implements a token-bucket rate limiter. If keyFn is set, one
+// bucket is maintained per key. Buckets that are idle and full are evicted
+// periodically since they behave the same as a new bucket.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	keyFn     KeyFunc
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func (rl *rateLimiter) name() string {
+	if rl.keyFn != nil {
+		return "keyed_rate"
+	}
+	return "rate"
+}
+
+func (rl *rateLimiter) acquire(ctx context.Context, job Job) (func(), error) {
+	var key string
+	if rl.keyFn != nil {
+		key = rl.keyFn(job)
+	}
+
+	// reservation happens with the lock held so that the bucket cannot be
+	// evicted in between.
+	now := time.Now()
+	rl.mu.Lock()
+	rl.sweep(now)
+	tb, found := rl.buckets[key]
+	if !found {
+		tb = &tokenBucket{rate: rl.rate, burst: float64(rl.burst), tokens: float64(rl.burst)}
+		rl.buckets[key] = tb
+	}
+	d := tb.reserve(now)
+	rl.mu.Unlock()
+
+	if err := tb.wait(ctx, d); err != nil {
+		return nil, err
+	}
+	return func() {}, nil
+}
+
+// sweep evicts the buckets that are full as of now. Must be called with the
+// lock held.
+func (rl *rateLimiter) sweep(now time.Time) {
+	interval := time.Duration(float64(rl.burst) / rl.rate * float64(time.Second))
+	if interval < bucketSweepInterval {
+		interval = bucketSweepInterval
+	}
+	if now.Sub(rl.lastSweep) < interval {
+		return
+	}
+	rl.lastSweep = now
+
+	for key, tb := range rl.buckets {
+		if tb.full(now) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second.
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks for the duration returned by reserve. If ctx is cancelled in
+// between, the reserved token is returned to the bucket.
+func (tb *tokenBucket) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		tb.unreserve()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// reserve takes a token (possibly going into debt) and returns the duration
+// after which the token is actually available.
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if !tb.last.IsZero() {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// full returns true if the bucket would be full at the given time.
+func (tb *tokenBucket) full(now time.Time) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	return tb.tokens+now.Sub(tb.last).Seconds()*tb.rate >= tb.burst
+}
+
+func (tb *tokenBucket) unreserve() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.tokens++
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+}
+
+// concurrencyLimiter limits the number of jobs of each type that can run at
+// once using one semaphore per type.
+type concurrencyLimiter struct {
+	typeFn KeyFunc
+	sems   map[string]chan struct{}
+}
+
+func (cl *concurrencyLimiter) name() string { return "concurrency" }
+
+func (cl *concurrencyLimiter) acquire(ctx context.Context, job Job) (func(), error) {
+	sem, found := cl.sems[cl.typeFn(job)]
+	if !found {
+		return func() {}, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	}
+}
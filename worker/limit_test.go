@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spy16/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_RateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var starts []time.Time
+	proc := ProcFn(func(_ context.Context, _ Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		starts = append(starts, time.Now())
+		return nil
+	})
+
+	jobs, _ := ackedJobs("a", "b", "c", "d", "e")
+	begin := time.Now()
+	summary, err := Run(context.Background(), jobs, WithProc(proc, 5), WithLogger(log.NoOpLogger{}), WithRateLimit(50, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.Processed)
+
+	// 2 jobs run right away as the burst and the remaining 3 are spaced by
+	// 20ms each.
+	assert.True(t, time.Since(begin) >= 55*time.Millisecond, "took only %s", time.Since(begin))
+	assert.Len(t, starts, 5)
+}
+
+func TestRun_KeyedRateLimit(t *testing.T) {
+	proc := ProcFn(func(_ context.Context, _ Job) error { return nil })
+	keyFn := func(job Job) string { return job.ID[:1] }
+
+	// every key has its own bucket, so jobs of distinct keys are not delayed.
+	jobs, _ := ackedJobs("a1", "b1", "c1", "d1")
+	begin := time.Now()
+	_, err := Run(context.Background(), jobs, WithProc(proc, 4), WithLogger(log.NoOpLogger{}), WithKeyedRateLimit(keyFn, 1, 1))
+	require.NoError(t, err)
+	assert.True(t, time.Since(begin) < 500*time.Millisecond, "took %s", time.Since(begin))
+}
+
+func TestRateLimiter_EvictsIdleBuckets(t *testing.T) {
+	rl := &rateLimiter{
+		rate:    10,
+		burst:   1,
+		keyFn:   func(job Job) string { return job.ID },
+		buckets: map[string]*tokenBucket{},
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		_, err := rl.acquire(context.Background(), Job{ID: id})
+		require.NoError(t, err)
+	}
+	require.Len(t, rl.buckets, 3)
+
+	now := time.Now()
+	rl.buckets["a"].last = now.Add(-time.Second)
+	rl.buckets["b"].last = now.Add(-time.Second)
+	rl.buckets["c"].last = now
+
+	rl.mu.Lock()
+	rl.lastSweep = time.Time{}
+	rl.sweep(now.Add(50 * time.Millisecond))
+	rl.mu.Unlock()
+	assert.Len(t, rl.buckets, 1, "only buckets that have refilled must be evicted")
+	assert.Contains(t, rl.buckets, "c")
+}
+
+func TestRun_RateLimitCancelled(t *testing.T) {
+	proc := ProcFn(func(_ context.Context, _ Job) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := &ackRecord{errs: map[string]error{}}
+	waiting := rec.job("waiting")
+	waiting.ctx = ctx
+
+	jobs := make(chan Job)
+	go func() {
+		jobs <- rec.job("first")
+		time.Sleep(10 * time.Millisecond)
+		jobs <- waiting
+		close(jobs)
+	}()
+	time.AfterFunc(30*time.Millisecond, cancel)
+
+	begin := time.Now()
+	summary, err := Run(context.Background(), jobs, WithProc(proc, 2), WithLogger(log.NoOpLogger{}), WithRateLimit(0.1, 1))
+	require.NoError(t, err)
+	assert.True(t, time.Since(begin) < time.Second, "took %s", time.Since(begin))
+	assert.Equal(t, Summary{Processed: 1, Rejected: 1}, summary)
+	assert.NoError(t, rec.get("first"))
+	assert.Equal(t, context.Canceled, rec.get("waiting"))
+}
+
+func TestRun_ConcurrencyLimit(t *testing.T) {
+	var active, maxActive, others int32
+	proc := ProcFn(func(_ context.Context, job Job) error {
+		if job.ID[0] != 'x' {
+			atomic.AddInt32(&others, 1)
+			return nil
+		}
+
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			cur := atomic.LoadInt32(&maxActive)
+			if n <= cur || atomic.CompareAndSwapInt32(&maxActive, cur, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	typeFn := func(job Job) string { return job.ID[:1] }
+
+	jobs, _ := ackedJobs("x1", "x2", "x3", "x4", "x5", "x6", "y1", "y2")
+	summary, err := Run(context.Background(), jobs, WithProc(proc, 6), WithLogger(log.NoOpLogger{}),
+		WithConcurrencyLimit(typeFn, map[string]int{"x": 2}))
+	require.NoError(t, err)
+	assert.Equal(t, 8, summary.Processed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxActive))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&others), "unlimited types must run")
+}
+
+func TestRun_ConcurrencyLimitCancelled(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	proc := ProcFn(func(_ context.Context, job Job) error {
+		if job.ID == "first" {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+	typeFn := func(Job) string { return "x" }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := &ackRecord{errs: map[string]error{}}
+	waiting := rec.job("waiting")
+	waiting.ctx = ctx
+
+	jobs := make(chan Job)
+	go func() {
+		jobs <- rec.job("first")
+		<-started
+		jobs <- waiting
+		close(jobs)
+	}()
+
+	time.AfterFunc(30*time.Millisecond, func() {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	})
+
+	_, err := Run(context.Background(), jobs, WithProc(proc, 2), WithLogger(log.NoOpLogger{}),
+		WithConcurrencyLimit(typeFn, map[string]int{"x": 1}))
+	require.NoError(t, err)
+	assert.NoError(t, rec.get("first"))
+	assert.Equal(t, context.Canceled, rec.get("waiting"))
+}
@@ -0,0 +1,212 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	_ Metrics = (*InMemMetrics)(nil)
+	_ Metrics = (*noOpMetrics)(nil)
+)
+
+// DefaultBuckets are the histogram bucket upper bounds (in seconds) used by
+// InMemMetrics when no buckets are specified.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics receives observations from a worker session. Implementations must
+// be safe for concurrent use.
+type Metrics interface {
+	// JobStarted is invoked before a job is passed to the proc. lag is the
+	// time elapsed since Job.Time (zero if Job.Time is not set).
+	JobStarted(job Job, lag time.Duration)
+
+	// JobFinished is invoked after the proc returns with the time it took
+	// and the error returned (if any).
+	JobFinished(job Job, latency time.Duration, err error)
+
+	// WorkersActive is invoked with the current number of active workers
+	// whenever a worker starts or exits.
+	WorkersActive(n int)
+
+	// LimiterWaited is invoked with the time the job spent waiting on the
+	// named limiter (e.g., 'rate', 'keyed_rate', 'concurrency').
+	LimiterWaited(job Job, limiter string, wait time.Duration)
+}
+
+// NewInMemMetrics returns an in-memory Metrics implementation. Latency and
+// queue lag histograms use the given bucket upper bounds (in seconds). If no
+// buckets are given, DefaultBuckets are used.
+func NewInMemMetrics(buckets ...float64) *InMemMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &InMemMetrics{
+		latency:  newHistogram(buckets),
+		queueLag: newHistogram(buckets),
+		limiters: map[string]*LimiterSnapshot{},
+	}
+}
+
+// InMemMetrics implements Metrics by aggregating the observations in memory.
+// Use Snapshot() to read the current values or PrometheusHandler() to expose
+// them over HTTP.
+type InMemMetrics struct {
+	mu        sync.Mutex
+	started   int64
+	succeeded int64
+	failed    int64
+	retried   int64
+	active    int64
+	latency   *histogram
+	queueLag  *histogram
+	limiters  map[string]*LimiterSnapshot
+}
+
+// MetricsSnapshot is a point-in-time copy of the values in InMemMetrics.
+type MetricsSnapshot struct {
+	Started       int64
+	Succeeded     int64
+	Failed        int64
+	Retried       int64
+	ActiveWorkers int64
+	Latency       HistogramSnapshot
+	QueueLag      HistogramSnapshot
+	Limiters      map[string]LimiterSnapshot
+}
+
+// LimiterSnapshot reports the number of jobs that passed through a limiter
+// and the total time they spent waiting on it.
+type LimiterSnapshot struct {
+	Count int64
+	Wait  time.Duration
+}
+
+// HistogramSnapshot is a point-in-time copy of a histogram. Counts[i] is the
+// cumulative number of observations less than or equal to Buckets[i].
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []int64
+	Count   int64
+	Sum     float64
+}
+
+// JobStarted records the start of a job. Jobs with non-zero Attempt are also
+// counted as retries.
+func (m *InMemMetrics) JobStarted(job Job, lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.started++
+	if job.Attempt > 0 {
+		m.retried++
+	}
+	if !job.Time.IsZero() {
+		m.queueLag.observe(lag.Seconds())
+	}
+}
+
+// JobFinished records the result and latency of a job.
+func (m *InMemMetrics) JobFinished(_ Job, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.failed++
+	} else {
+		m.succeeded++
+	}
+	m.latency.observe(latency.Seconds())
+}
+
+// WorkersActive records the number of active workers.
+func (m *InMemMetrics) WorkersActive(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = int64(n)
+}
+
+// LimiterWaited records the time spent by a job waiting on a limiter.
+func (m *InMemMetrics) LimiterWaited(_ Job, limiter string, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ls, found := m.limiters[limiter]
+	if !found {
+		ls = &LimiterSnapshot{}
+		m.limiters[limiter] = ls
+	}
+	ls.Count++
+	ls.Wait += wait
+}
+
+// Snapshot returns a copy of the current values.
+func (m *InMemMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limiters := make(map[string]LimiterSnapshot, len(m.limiters))
+	for name, ls := range m.limiters {
+		limiters[name] = *ls
+	}
+
+	return MetricsSnapshot{
+		Started:       m.started,
+		Succeeded:     m.succeeded,
+		Failed:        m.failed,
+		Retried:       m.retried,
+		ActiveWorkers: m.active,
+		Latency:       m.latency.snapshot(),
+		QueueLag:      m.queueLag.snapshot(),
+		Limiters:      limiters,
+	}
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]int64, len(buckets)),
+	}
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []int64 // non-cumulative count per bucket.
+	count   int64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	snap := HistogramSnapshot{
+		Buckets: append([]float64(nil), h.buckets...),
+		Counts:  make([]int64, len(h.counts)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+
+	var cumulative int64
+	for i, c := range h.counts {
+		cumulative += c
+		snap.Counts[i] = cumulative
+	}
+	return snap
+}
+
+type noOpMetrics struct{}
+
+func (noOpMetrics) JobStarted(Job, time.Duration)            {}
+func (noOpMetrics) JobFinished(Job, time.Duration, error)    {}
+func (noOpMetrics) WorkersActive(int)                        {}
+func (noOpMetrics) LimiterWaited(Job, string, time.Duration) {}
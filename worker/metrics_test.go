@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemMetrics(t *testing.T) {
+	m := NewInMemMetrics(0.1, 1)
+
+	ch := make(chan Job, 3)
+	ch <- Job{ID: "1", Time: time.Now()}
+	ch <- Job{ID: "2", Attempt: 1}
+	ch <- Job{ID: "3"}
+	close(ch)
+
+	proc := ProcFn(func(_ context.Context, job Job) error {
+		if job.ID == "3" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	summary, err := Run(context.Background(), ch, WithProc(proc, 1), WithMetrics(m))
+	require.NoError(t, err)
+	assert.Equal(t, 3, summary.Processed)
+	assert.Equal(t, 1, summary.Failed)
+
+	snap := m.Snapshot()
+	assert.Equal(t, int64(3), snap.Started)
+	assert.Equal(t, int64(2), snap.Succeeded)
+	assert.Equal(t, int64(1), snap.Failed)
+	assert.Equal(t, int64(1), snap.Retried)
+	assert.Equal(t, int64(0), snap.ActiveWorkers)
+	assert.Equal(t, int64(3), snap.Latency.Count)
+	assert.Equal(t, []int64{3, 3}, snap.Latency.Counts)
+	assert.Equal(t, int64(1), snap.QueueLag.Count)
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler(m, "").ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE worker_jobs_started_total counter\nworker_jobs_started_total 3\n")
+	assert.Contains(t, body, "worker_job_latency_seconds_bucket{le=\"0.1\"} 3\n")
+	assert.Contains(t, body, "worker_job_latency_seconds_bucket{le=\"+Inf\"} 3\n")
+	assert.Contains(t, body, "worker_job_latency_seconds_count 3\n")
+}
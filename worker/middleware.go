@@ -0,0 +1,186 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/spy16/pkg/log"
+)
+
+// ErrDuplicate is returned by the Dedup middleware when a job with the same
+// id is already being processed.
+var ErrDuplicate = errors.New("duplicate job is already in progress")
+
+// Middleware wraps a Proc to add cross-cutting behaviour.
+type Middleware func(next Proc) Proc
+
+// Chain combines the middlewares into one. The first middleware is the
+// outermost, i.e., Chain(a, b)(proc) is same as a(b(proc)).
+func Chain(mws ...Middleware) Middleware {
+	return func(next Proc) Proc {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// Logging returns a middleware that logs the start and the result of every
+// job as key=value pairs using the logger.
+func Logging(lg log.Logger) Middleware {
+	if lg == nil {
+		lg = log.NoOpLogger{}
+	}
+
+	return func(next Proc) Proc {
+		return ProcFn(func(ctx context.Context, job Job) error {
+			lg.Debugf("msg=\"job started\" job_id=%s attempt=%d", job.ID, job.Attempt)
+
+			start := time.Now()
+			err := next.Exec(ctx, job)
+			elapsed := time.Since(start)
+
+			if err != nil {
+				lg.Errorf("msg=\"job failed\" job_id=%s attempt=%d duration=%s error=%q",
+					job.ID, job.Attempt, elapsed, err.Error())
+			} else {
+				lg.Infof("msg=\"job succeeded\" job_id=%s attempt=%d duration=%s",
+					job.ID, job.Attempt, elapsed)
+			}
+			return err
+		})
+	}
+}
+
+// Timing returns a middleware that reports the time taken by every job along
+// with its result to the given func.
+func Timing(report func(job Job, elapsed time.Duration, err error)) Middleware {
+	return func(next Proc) Proc {
+		return ProcFn(func(ctx context.Context, job Job) error {
+			start := time.Now()
+			err := next.Exec(ctx, job)
+			report(job, time.Since(start), err)
+			return err
+		})
+	}
+}
+
+// Recover returns a middleware that converts panics in the wrapped proc into
+// PanicError and logs them using the logger. Worker sessions always recover
+// from panics; this is useful when the Proc is invoked outside a session.
+func Recover(lg log.Logger) Middleware {
+	if lg == nil {
+		lg = log.NoOpLogger{}
+	}
+
+	return func(next Proc) Proc {
+		return ProcFn(func(ctx context.Context, job Job) error {
+			return safeExec(ctx, next, job, func(pe *PanicError) {
+				lg.Errorf("proc panicked on job '%s': %v\n%s", job.ID, pe.Value, pe.Stack)
+			})
+		})
+	}
+}
+
+// Dedup returns a middleware that processes a job id at most once within the
+// ttl. Jobs whose id was processed successfully within the ttl are skipped
+// and reported as successful. Jobs whose id is currently being processed fail
+// with ErrDuplicate so that they can be retried later.
+func Dedup(ttl time.Duration) Middleware {
+	cache := &ttlCache{ttl: ttl, entries: map[string]dedupEntry{}}
+
+	return func(next Proc) Proc {
+		return ProcFn(func(ctx context.Context, job Job) error {
+			if done, claimed := cache.claim(job.ID); done {
+				return nil
+			} else if !claimed {
+				return ErrDuplicate
+			}
+
+			// a panic leaves succeeded false so that the claim is dropped
+			// and the job can be redelivered.
+			succeeded := false
+			defer func() { cache.release(job.ID, succeeded) }()
+
+			err := next.Exec(ctx, job)
+			succeeded = err == nil
+			return err
+		})
+	}
+}
+
+// safeExec invokes the proc and converts any panic into a PanicError which
+// is also passed to onPanic.
+func safeExec(ctx context.Context, proc Proc, job Job, onPanic func(pe *PanicError)) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			pe := &PanicError{Value: v, Stack: debug.Stack()}
+			onPanic(pe)
+			err = pe
+		}
+	}()
+
+	return proc.Exec(ctx, job)
+}
+
+// dedupEntry is either an in-progress claim (done=false) or a completed id
+// (done=true). Only completed ids expire; claims are held until released.
+type dedupEntry struct {
+	done    bool
+	expires time.Time
+}
+
+type ttlCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]dedupEntry
+	lastSweep time.Time
+}
+
+// claim marks the id as in-progress. Returns done=true if the id was already
+// processed successfully and claimed=false if it is in progress.
+func (c *ttlCache) claim(id string) (done bool, claimed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.sweep(now)
+
+	if e, found := c.entries[id]; found && (!e.done || now.Before(e.expires)) {
+		return e.done, false
+	}
+	c.entries[id] = dedupEntry{}
+	return false, true
+}
+
+// release marks the id as processed if succeeded is true. Otherwise, the id is
+// forgotten so that the job can be retried.
+func (c *ttlCache) release(id string, succeeded bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !succeeded {
+		delete(c.entries, id)
+		return
+	}
+	c.entries[id] = dedupEntry{done: true, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *ttlCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+
+	for id, e := range c.entries {
+		if !e.done {
+			continue
+		}
+		if !now.Before(e.expires) {
+			delete(c.entries, id)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next Proc) Proc {
+			return ProcFn(func(ctx context.Context, job Job) error {
+				order = append(order, name+":before")
+				err := next.Exec(ctx, job)
+				order = append(order, name+":after")
+				return err
+			})
+		}
+	}
+	proc := ProcFn(func(_ context.Context, _ Job) error {
+		order = append(order, "proc")
+		return nil
+	})
+
+	err := Chain(mw("a"), mw("b"))(proc).Exec(context.Background(), Job{ID: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:before", "b:before", "proc", "b:after", "a:after"}, order)
+}
+
+func TestDedup(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	t.Run("SkipsProcessed", func(t *testing.T) {
+		calls := 0
+		proc := Dedup(time.Minute)(ProcFn(func(_ context.Context, _ Job) error {
+			calls++
+			return nil
+		}))
+
+		assert.NoError(t, proc.Exec(context.Background(), Job{ID: "1"}))
+		assert.NoError(t, proc.Exec(context.Background(), Job{ID: "1"}))
+		assert.NoError(t, proc.Exec(context.Background(), Job{ID: "2"}))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("RetriesFailed", func(t *testing.T) {
+		calls := 0
+		proc := Dedup(time.Minute)(ProcFn(func(_ context.Context, _ Job) error {
+			calls++
+			if calls == 1 {
+				return errFailed
+			}
+			return nil
+		}))
+
+		assert.Equal(t, errFailed, proc.Exec(context.Background(), Job{ID: "1"}))
+		assert.NoError(t, proc.Exec(context.Background(), Job{ID: "1"}))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("InProgress", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		proc := Dedup(time.Millisecond)(ProcFn(func(_ context.Context, _ Job) error {
+			close(started)
+			<-release
+			return nil
+		}))
+
+		done := make(chan error)
+		go func() { done <- proc.Exec(context.Background(), Job{ID: "1"}) }()
+		<-started
+
+		// the claim must be held beyond the ttl while the job is running.
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal(t, ErrDuplicate, proc.Exec(context.Background(), Job{ID: "1"}))
+
+		close(release)
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		calls := 0
+		proc := Dedup(5 * time.Millisecond)(ProcFn(func(_ context.Context, _ Job) error {
+			calls++
+			return nil
+		}))
+
+		assert.NoError(t, proc.Exec(context.Background(), Job{ID: "1"}))
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, proc.Exec(context.Background(), Job{ID: "1"}))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		calls := 0
+		proc := Dedup(time.Minute)(ProcFn(func(_ context.Context, _ Job) error {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			return nil
+		}))
+
+		assert.Panics(t, func() { _ = proc.Exec(context.Background(), Job{ID: "1"}) })
+		assert.NoError(t, proc.Exec(context.Background(), Job{ID: "1"}), "redelivery must not be a duplicate")
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestLogging(t *testing.T) {
+	lg := &recordingLogger{}
+	proc := Logging(lg)(ProcFn(func(_ context.Context, job Job) error {
+		if job.ID == "bad" {
+			return errors.New("failed")
+		}
+		return nil
+	}))
+
+	assert.NoError(t, proc.Exec(context.Background(), Job{ID: "good", Attempt: 1}))
+	assert.Error(t, proc.Exec(context.Background(), Job{ID: "bad"}))
+
+	lines := lg.get()
+	require.Len(t, lines, 4)
+	assert.Equal(t, `DEBUG msg="job started" job_id=good attempt=1`, lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], `INFO msg="job succeeded" job_id=good attempt=1 duration=`), lines[1])
+	assert.Equal(t, `DEBUG msg="job started" job_id=bad attempt=0`, lines[2])
+	assert.True(t, strings.HasPrefix(lines[3], `ERROR msg="job failed" job_id=bad attempt=0 duration=`), lines[3])
+	assert.True(t, strings.HasSuffix(lines[3], `error="failed"`), lines[3])
+}
+
+// recordingLogger is a log.Logger that records the formatted lines prefixed
+// with the level.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (rl *recordingLogger) Debugf(msg string, args ...interface{}) { rl.add("DEBUG", msg, args) }
+func (rl *recordingLogger) Infof(msg string, args ...interface{})  { rl.add("INFO", msg, args) }
+func (rl *recordingLogger) Warnf(msg string, args ...interface{})  { rl.add("WARN", msg, args) }
+func (rl *recordingLogger) Errorf(msg string, args ...interface{}) { rl.add("ERROR", msg, args) }
+
+func (rl *recordingLogger) add(level, msg string, args []interface{}) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.lines = append(rl.lines, level+" "+fmt.Sprintf(msg, args...))
+}
+
+func (rl *recordingLogger) get() []string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return append([]string(nil), rl.lines...)
+}
@@ -0,0 +1,321 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Lane is a named source of jobs for Mux.
+type Lane struct {
+	Name   string
+	Stream Stream
+
+	// Priority of the lane. Jobs from a lane with higher priority are always
+	// dispatched before jobs from lanes with lower priority.
+	Priority int
+
+	// Weight is the relative share of dispatches among the lanes with same
+	// priority. Defaults to 1.
+	Weight int
+
+	// MaxConcurrency is the maximum number of jobs from this lane that can
+	// be in-flight (i.e., dispatched but not acked) at once. Zero means no
+	// limit.
+	MaxConcurrency int
+}
+
+// LaneStats reports the activity of one lane in Mux.
+type LaneStats struct {
+	Name       string
+	Dispatched int64         // jobs dispatched to the session.
+	Succeeded  int64         // jobs acked without error.
+	Failed     int64         // jobs acked with error.
+	InFlight   int           // jobs dispatched but not acked yet.
+	AvgWait    time.Duration // average time a job waited in the mux.
+}
+
+// NewMux returns a Mux that multiplexes the given lanes into a single stream.
+func NewMux(lanes ...Lane) (*Mux, error) {
+	if len(lanes) == 0 {
+		return nil, errors.New("at least one lane is required")
+	}
+
+	m := &Mux{
+		ready:   make(chan struct{}, 1),
+		vclocks: map[int]float64{},
+	}
+	seen := map[string]bool{}
+	for _, l := range lanes {
+		if l.Name == "" || l.Stream == nil {
+			return nil, errors.New("lane must have a name and a stream")
+		} else if seen[l.Name] {
+			return nil, fmt.Errorf("duplicate lane '%s'", l.Name)
+		}
+		seen[l.Name] = true
+
+		if l.Weight <= 0 {
+			l.Weight = 1
+		}
+		m.lanes = append(m.lanes, &muxLane{Lane: l})
+	}
+	return m, nil
+}
+
+// Mux combines multiple lanes into one Stream using strict priority across
+// priority levels and weighted fair queuing among lanes of same priority.
+type Mux struct {
+	mu      sync.Mutex
+	lanes   []*muxLane
+	ready   chan struct{}
+	started bool
+
+	// vclocks tracks the virtual time of each priority level. It is the
+	// start tag of the job last dispatched from the level and never moves
+	// backwards.
+	vclocks map[int]float64
+}
+
+type muxLane struct {
+	Lane
+
+	slot chan Job // holds at most one job received from the lane stream.
+	done chan struct{}
+
+	head     *Job
+	headAt   time.Time
+	vtime    float64
+	inFlight int
+	stats    LaneStats
+	waitSum  time.Duration
+}
+
+// Stats returns the current stats of all the lanes.
+func (m *Mux) Stats() []LaneStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]LaneStats, 0, len(m.lanes))
+	for _, l := range m.lanes {
+		s := l.stats
+		s.Name = l.Name
+		s.InFlight = l.inFlight
+		if s.Dispatched > 0 {
+			s.AvgWait = l.waitSum / time.Duration(s.Dispatched)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Stream returns a Stream that emits jobs from all the lanes. The stream is
+// closed once all the lane streams are closed or the ctx is cancelled. Jobs
+// that were received from the lanes but not emitted when the ctx is cancelled
+// are acked with the ctx error. The returned Stream can be started only once.
+func (m *Mux) Stream(buffer int) Stream {
+	return func(ctx context.Context) (<-chan Job, error) {
+		m.mu.Lock()
+		if m.started {
+			m.mu.Unlock()
+			return nil, errors.New("mux stream is already started")
+		}
+		m.started = true
+		m.mu.Unlock()
+
+		for _, l := range m.lanes {
+			src, err := l.Stream(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("lane '%s': %v", l.Name, err)
+			}
+
+			l.slot = make(chan Job, 1)
+			l.done = make(chan struct{})
+			go m.forward(ctx, l, src)
+		}
+
+		out := make(chan Job, buffer)
+		go func() {
+			defer close(out)
+			m.dispatch(ctx, out)
+			m.release(ctx.Err())
+		}()
+		return out, nil
+	}
+}
+
+func (m *Mux) forward(ctx context.Context, l *muxLane, src <-chan Job) {
+	defer func() {
+		// done must be closed before signalling, so that dispatch sees the
+		// lane as exhausted when it wakes up.
+		close(l.done)
+		m.signal()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case j, ok := <-src:
+			if !ok {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				ackJob(j, ctx.Err())
+				return
+			case l.slot <- j:
+				m.signal()
+			}
+		}
+	}
+}
+
+func (m *Mux) dispatch(ctx context.Context, out chan<- Job) {
+	for {
+		job, finished := m.next()
+		if finished {
+			return
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.ready:
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			// job is already counted as in-flight; acking settles both
+			// the lane and the upstream job.
+			job.Ack(ctx.Err())
+			return
+		case out <- *job:
+		}
+	}
+}
+
+// release acks the jobs held by the lanes once the forwarders exit. Must be
+// called only after dispatch returns.
+func (m *Mux) release(err error) {
+	if err == nil {
+		// all the lanes are exhausted.
+		return
+	}
+
+	for _, l := range m.lanes {
+		<-l.done
+
+		m.mu.Lock()
+		head := l.head
+		l.head = nil
+		m.mu.Unlock()
+
+		if head != nil {
+			ackJob(*head, err)
+		}
+		for len(l.slot) > 0 {
+			ackJob(<-l.slot, err)
+		}
+	}
+}
+
+// next picks the next job to be dispatched. Returns nil if no lane has a job
+// that can be dispatched now and finished=true if all lanes are exhausted.
+func (m *Mux) next() (job *Job, finished bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	finished = true
+	var pick *muxLane
+	for _, l := range m.lanes {
+		if l.head == nil {
+			select {
+			case j := <-l.slot:
+				l.head, l.headAt = &j, time.Now()
+				if vclock := m.vclocks[l.Priority]; l.vtime < vclock {
+					// idle lanes must not accumulate credit.
+					l.vtime = vclock
+				}
+			default:
+			}
+		}
+
+		if l.head == nil {
+			select {
+			case <-l.done:
+				if len(l.slot) > 0 {
+					finished = false
+				}
+			default:
+				finished = false
+			}
+			continue
+		}
+		finished = false
+
+		if l.MaxConcurrency > 0 && l.inFlight >= l.MaxConcurrency {
+			continue
+		}
+
+		if pick == nil || l.Priority > pick.Priority ||
+			(l.Priority == pick.Priority && l.vtime+1/float64(l.Weight) < pick.vtime+1/float64(pick.Weight)) {
+			pick = l
+		}
+	}
+
+	if pick == nil {
+		return nil, finished
+	}
+
+	j := *pick.head
+	pick.head = nil
+	if pick.vtime > m.vclocks[pick.Priority] {
+		m.vclocks[pick.Priority] = pick.vtime
+	}
+	pick.vtime += 1 / float64(pick.Weight)
+	pick.inFlight++
+	pick.stats.Dispatched++
+	pick.waitSum += time.Since(pick.headAt)
+
+	ack := j.Ack
+	var once sync.Once
+	j.Ack = func(err error) {
+		once.Do(func() { m.acked(pick, err) })
+		if ack != nil {
+			ack(err)
+		}
+	}
+	return &j, false
+}
+
+func (m *Mux) acked(l *muxLane, err error) {
+	m.mu.Lock()
+	l.inFlight--
+	if err != nil {
+		l.stats.Failed++
+	} else {
+		l.stats.Succeeded++
+	}
+	m.mu.Unlock()
+	m.signal()
+}
+
+func ackJob(j Job, err error) {
+	if j.Ack != nil {
+		j.Ack(err)
+	}
+}
+
+func (m *Mux) signal() {
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
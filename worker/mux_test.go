@@ -0,0 +1,172 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMux_Weights(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m, err := NewMux(
+		Lane{Name: "a", Stream: jobStream("a", 200), Weight: 3},
+		Lane{Name: "b", Stream: jobStream("b", 200), Weight: 1},
+	)
+	require.NoError(t, err)
+
+	counts := map[string]int{}
+	for _, j := range readJobs(t, mustStream(t, ctx, m.Stream(0)), 100) {
+		counts[j.Payload.(string)]++
+	}
+	assert.InDelta(t, 75, counts["a"], 5)
+	assert.InDelta(t, 25, counts["b"], 5)
+}
+
+func TestMux_Priority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	low := func(ctx context.Context) (<-chan Job, error) {
+		ch := make(chan Job)
+		go func() {
+			defer close(ch)
+			// becomes ready only after some high priority jobs are dispatched.
+			time.Sleep(20 * time.Millisecond)
+			src, _ := jobStream("low", 5)(ctx)
+			for j := range src {
+				ch <- j
+			}
+		}()
+		return ch, nil
+	}
+
+	m, err := NewMux(
+		Lane{Name: "high", Stream: jobStream("high", 10), Priority: 1},
+		Lane{Name: "low", Stream: low, Weight: 100},
+	)
+	require.NoError(t, err)
+	out := mustStream(t, ctx, m.Stream(0))
+
+	readJobs(t, out, 5)
+	time.Sleep(30 * time.Millisecond)
+
+	var lanes []string
+	for _, j := range readJobs(t, out, 10) {
+		lanes = append(lanes, j.Payload.(string))
+	}
+	assert.Equal(t, []string{"high", "high", "high", "high", "high", "low", "low", "low", "low", "low"}, lanes)
+}
+
+func TestMux_MaxConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m, err := NewMux(Lane{Name: "a", Stream: jobStream("a", 3), MaxConcurrency: 1})
+	require.NoError(t, err)
+	out := mustStream(t, ctx, m.Stream(0))
+
+	j1 := readJobs(t, out, 1)[0]
+	select {
+	case j := <-out:
+		t.Fatalf("job '%s' dispatched beyond the concurrency limit", j.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	j1.Ack(nil)
+	j2 := readJobs(t, out, 1)[0]
+	j2.Ack(errors.New("failed"))
+	j3 := readJobs(t, out, 1)[0]
+
+	stats := m.Stats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "a", stats[0].Name)
+	assert.Equal(t, int64(3), stats[0].Dispatched)
+	assert.Equal(t, int64(1), stats[0].Succeeded)
+	assert.Equal(t, int64(1), stats[0].Failed)
+	assert.Equal(t, 1, stats[0].InFlight)
+
+	j3.Ack(nil)
+	select {
+	case _, ok := <-out:
+		assert.False(t, ok, "expected stream to be closed")
+	case <-time.After(time.Second):
+		t.Fatal("stream was not closed after lane was exhausted")
+	}
+}
+
+func TestMux_Close(t *testing.T) {
+	for i := 0; i < 2000; i++ {
+		m, err := NewMux(Lane{Name: "a", Stream: jobStream("a", 1)})
+		require.NoError(t, err)
+		out := mustStream(t, context.Background(), m.Stream(0))
+
+		readJobs(t, out, 1)
+		select {
+		case _, ok := <-out:
+			require.False(t, ok, "expected stream to be closed")
+		case <-time.After(time.Second):
+			t.Fatalf("iteration %d: stream was not closed after lane was exhausted", i)
+		}
+	}
+}
+
+func TestMux_CancelReleases(t *testing.T) {
+	jobs, acks := ackedJobs("1", "2", "3")
+	m, err := NewMux(Lane{Name: "lane", Stream: func(context.Context) (<-chan Job, error) { return jobs, nil }})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = m.Stream(0)(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Stream(0)(ctx)
+	assert.Error(t, err, "stream must not be started twice")
+
+	// nothing is consumed: one job is blocked in dispatch, one is in the
+	// lane slot and one is blocked in the forwarder.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	for _, id := range []string{"1", "2", "3"} {
+		id := id
+		assert.Eventually(t, func() bool { return acks.get(id) == context.Canceled }, time.Second, time.Millisecond,
+			"job %s must be acked with ctx error", id)
+	}
+	assert.Equal(t, 0, m.Stats()[0].InFlight)
+}
+
+// jobStream returns a stream that emits n jobs with name as the payload.
+func jobStream(name string, n int) Stream {
+	return func(ctx context.Context) (<-chan Job, error) {
+		ch := make(chan Job, n)
+		for i := 0; i < n; i++ {
+			ch <- Job{ID: fmt.Sprintf("%s-%d", name, i), Payload: name}
+		}
+		close(ch)
+		return ch, nil
+	}
+}
+
+// readJobs reads n jobs from the channel, pausing between reads so that the
+// lanes are refilled.
+func readJobs(t *testing.T, ch <-chan Job, n int) []Job {
+	var jobs []Job
+	for i := 0; i < n; i++ {
+		select {
+		case j, ok := <-ch:
+			require.True(t, ok, "stream closed after %d jobs", i)
+			jobs = append(jobs, j)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for job %d", i)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return jobs
+}
@@ -1,6 +1,12 @@
 package worker
 
-import "github.com/spy16/pkg/log"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spy16/pkg/log"
+)
 
 // Option can be provided to Run() to customise run behaviour of the worker.
 type Option func(ws *workerSession) error
@@ -8,6 +14,7 @@ type Option func(ws *workerSession) error
 func withDefaults(opts []Option) []Option {
 	return append([]Option{
 		WithLogger(log.StdLogger{}),
+		WithMetrics(nil),
 		WithProc(nil, 1),
 	}, opts...)
 }
@@ -34,3 +41,154 @@ func WithLogger(lg log.Logger) Option {
 		return nil
 	}
 }
+
+// WithJobTimeout sets a hard deadline for processing each Job. The context
+// passed to Proc.Exec is cancelled once the timeout elapses. Zero or negative
+// timeout disables the deadline.
+func WithJobTimeout(timeout time.Duration) Option {
+	return func(ws *workerSession) error {
+		ws.jobTimeout = timeout
+		return nil
+	}
+}
+
+// WithWatchdog enables reporting of jobs that keep running beyond the given
+// soft deadline. Overdue jobs are logged as warnings and passed to onOverdue
+// if it is not nil. Unlike WithJobTimeout, the job is not interrupted.
+func WithWatchdog(softDeadline time.Duration, onOverdue func(job Job, elapsed time.Duration)) Option {
+	return func(ws *workerSession) error {
+		ws.softDeadline = softDeadline
+		ws.onOverdue = onOverdue
+		return nil
+	}
+}
+
+// WithDrain enables the graceful drain mode. When the context passed to Run
+// is cancelled, workers stop pulling new jobs and the in-flight jobs are given
+// the grace period to finish before their context is cancelled. Jobs still
+// buffered in the stream are then passed to handOff or, if handOff is nil,
+// acknowledged with ErrDrained.
+func WithDrain(grace time.Duration, handOff func(job Job)) Option {
+	return func(ws *workerSession) error {
+		ws.drain = true
+		ws.drainGrace = grace
+		ws.handOff = handOff
+		return nil
+	}
+}
+
+// WithMetrics sets the Metrics to be notified of job and worker activity.
+// If nil, metrics collection is disabled.
+func WithMetrics(m Metrics) Option {
+	return func(ws *workerSession) error {
+		if m == nil {
+			m = noOpMetrics{}
+		}
+		ws.metrics = m
+		return nil
+	}
+}
+
+// WithAutoScaler enables autoscaling of the worker pool between as.Min and
+// as.Max workers. The worker count passed to WithProc is ignored when an
+// autoscaler is set. as.Size() can be used to observe the current size.
+func WithAutoScaler(as *AutoScaler) Option {
+	return func(ws *workerSession) error {
+		if as != nil {
+			ws.scaler = newScaler(as)
+		}
+		return nil
+	}
+}
+
+// WithKeyFunc enables keyed ordering. Each worker gets a dedicated lane and
+// jobs are routed to lanes by the hash of the key returned by keyFn. Jobs with
+// the same key are thus executed serially in arrival order while jobs with
+// different keys can still run in parallel. Cannot be used with autoscaling.
+func WithKeyFunc(keyFn KeyFunc) Option {
+	return func(ws *workerSession) error {
+		ws.keyFn = keyFn
+		return nil
+	}
+}
+
+// WithRateLimit limits the rate at which jobs are executed across all the
+// workers to 'rate' jobs per second with bursts of up to 'burst' jobs.
+func WithRateLimit(rate float64, burst int) Option {
+	return WithKeyedRateLimit(nil, rate, burst)
+}
+
+// WithKeyedRateLimit is like WithRateLimit but maintains a separate token
+// bucket for each key returned by keyFn. If keyFn is nil, a single bucket is
+// used for all jobs.
+func WithKeyedRateLimit(keyFn KeyFunc, rate float64, burst int) Option {
+	return func(ws *workerSession) error {
+		if rate <= 0 {
+			return errors.New("rate must be positive")
+		}
+		if burst < 1 {
+			burst = 1
+		}
+
+		ws.limiters = append(ws.limiters, &rateLimiter{
+			rate:    rate,
+			burst:   burst,
+			keyFn:   keyFn,
+			buckets: map[string]*tokenBucket{},
+		})
+		return nil
+	}
+}
+
+// WithConcurrencyLimit limits the number of jobs of each type that can run
+// concurrently. typeFn returns the type of the job and limits maps the type
+// to the maximum concurrency. Types not present in limits are not limited.
+func WithConcurrencyLimit(typeFn KeyFunc, limits map[string]int) Option {
+	return func(ws *workerSession) error {
+		cl := &concurrencyLimiter{typeFn: typeFn, sems: map[string]chan struct{}{}}
+		for typ, limit := range limits {
+			if limit <= 0 {
+				return fmt.Errorf("concurrency limit for '%s' must be positive", typ)
+			}
+			cl.sems[typ] = make(chan struct{}, limit)
+		}
+
+		ws.limiters = append(ws.limiters, cl)
+		return nil
+	}
+}
+
+// WithBatchProc sets the BatchProc to be invoked with batches of jobs instead
+// of a Proc per job. Each worker accumulates up to maxSize jobs or whatever it
+// receives within maxWait of the first job in the batch. Jobs are acked
+// individually based on the per-job errors returned by the proc. Batch
+// processing cannot be combined with autoscaling, limits or middlewares.
+func WithBatchProc(proc BatchProc, maxSize int, maxWait time.Duration, workerCount int) Option {
+	return func(ws *workerSession) error {
+		if proc == nil {
+			return errors.New("batch proc must not be nil")
+		}
+		if maxSize <= 0 {
+			maxSize = 1
+		}
+		if maxWait <= 0 {
+			maxWait = time.Second
+		}
+
+		ws.batchProc = proc
+		ws.batchSize = maxSize
+		ws.batchWait = maxWait
+		ws.workers = workerCount
+		return nil
+	}
+}
+
+// WithMiddleware wraps the Proc with the given middlewares. The middlewares
+// are applied in the order given (first one is the outermost) and multiple
+// WithMiddleware options accumulate.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(ws *workerSession) error {
+		ws.middlewares = append(ws.middlewares, mws...)
+		return nil
+	}
+}
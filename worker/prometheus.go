@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// PrometheusHandler returns an http.Handler that renders the metrics in the
+// Prometheus text exposition format. All metric names are prefixed with the
+// namespace (e.g., 'myapp_worker'). If namespace is empty, 'worker' is used.
+func PrometheusHandler(m *InMemMetrics, namespace string) http.Handler {
+	if namespace == "" {
+		namespace = "worker"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		snap := m.Snapshot()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		defer func() { _ = bw.Flush() }()
+
+		writeCounter(bw, namespace+"_jobs_started_total", "Number of jobs started.", snap.Started)
+		writeCounter(bw, namespace+"_jobs_succeeded_total", "Number of jobs processed successfully.", snap.Succeeded)
+		writeCounter(bw, namespace+"_jobs_failed_total", "Number of jobs that failed.", snap.Failed)
+		writeCounter(bw, namespace+"_jobs_retried_total", "Number of jobs started with a non-zero attempt.", snap.Retried)
+		writeGauge(bw, namespace+"_active_workers", "Number of active workers.", snap.ActiveWorkers)
+		writeHistogram(bw, namespace+"_job_latency_seconds", "Time taken by the proc to process a job.", snap.Latency)
+		writeHistogram(bw, namespace+"_queue_lag_seconds", "Time between job creation and start of processing.", snap.QueueLag)
+		writeLimiters(bw, namespace, snap.Limiters)
+	})
+}
+
+func writeCounter(w *bufio.Writer, name, help string, v int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+}
+
+func writeGauge(w *bufio.Writer, name, help string, v int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, v)
+}
+
+func writeHistogram(w *bufio.Writer, name, help string, h HistogramSnapshot) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, le := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(le), h.Counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.Sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.Count)
+}
+
+func writeLimiters(w *bufio.Writer, namespace string, limiters map[string]LimiterSnapshot) {
+	if len(limiters) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(limiters))
+	for name := range limiters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	count := namespace + "_limiter_acquired_total"
+	fmt.Fprintf(w, "# HELP %s Number of jobs that acquired the limiter.\n# TYPE %s counter\n", count, count)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s{limiter=\"%s\"} %d\n", count, name, limiters[name].Count)
+	}
+
+	wait := namespace + "_limiter_wait_seconds_total"
+	fmt.Fprintf(w, "# HELP %s Total time jobs spent waiting on the limiter.\n# TYPE %s counter\n", wait, wait)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s{limiter=\"%s\"} %s\n", wait, name, formatFloat(limiters[name].Wait.Seconds()))
+	}
+}
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
@@ -0,0 +1,516 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spy16/pkg/log"
+)
+
+const (
+	opEnqueue = "enq"
+	opLease   = "lease"
+	opAck     = "ack"
+
+	// compactAfter is the minimum number of records in the log before it
+	// is considered for compaction.
+	compactAfter = 1024
+
+	recHeaderSz = 8 // 4 byte length + 4 byte crc32 checksum.
+	maxRecordSz = 64 << 20
+)
+
+// ErrQueueClosed is returned by Queue operations after the queue is closed.
+var ErrQueueClosed = errors.New("queue is closed")
+
+// errStaleLease is returned when a job is acked using a lease that has
+// expired and has been superseded by a newer lease.
+var errStaleLease = errors.New("lease has expired")
+
+// OpenQueue opens the durable queue backed by the append-only log file at the
+// given path, creating it if required. Jobs that were enqueued but not acked
+// before a crash/restart become available for lease again. A leased job that
+// is not acked within the visibility timeout is made available again. If
+// visibility is zero, 30 seconds is used.
+func OpenQueue(path string, visibility time.Duration) (*Queue, error) {
+	if visibility <= 0 {
+		visibility = 30 * time.Second
+	}
+
+	q := &Queue{
+		Logger:     log.StdLogger{},
+		path:       path,
+		visibility: visibility,
+		entries:    map[string]*queueEntry{},
+		leased:     map[string]*queueEntry{},
+		wake:       make(chan struct{}),
+	}
+
+	if err := q.recover(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	q.file = f
+
+	return q, nil
+}
+
+// Queue is a durable, file-backed job queue with at-least-once delivery. Jobs
+// are leased in FIFO order. Queue is safe for concurrent use. The Logger is
+// used to report failures while acking the leased jobs.
+type Queue struct {
+	log.Logger
+
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	visibility time.Duration
+	entries    map[string]*queueEntry
+	records    int
+	seq        uint64
+	wake       chan struct{}
+	closed     bool
+
+	// order holds the entries in FIFO order. Entries before head have been
+	// leased at least once (or acked) and are tracked in leased until they
+	// are acked. order is trimmed only when the log is compacted.
+	order  []*queueEntry
+	head   int
+	leased map[string]*queueEntry
+}
+
+type queueEntry struct {
+	ID          string    `json:"id"`
+	Op          string    `json:"op"`
+	Time        time.Time `json:"time,omitempty"`
+	Attempt     int       `json:"attempt,omitempty"`
+	Payload     []byte    `json:"payload,omitempty"`
+	leasedUntil time.Time
+	lease       uint64 // incremented on every lease.
+	seq         uint64 // position in the FIFO order.
+	acked       bool
+}
+
+// Enqueue durably appends a job with the given id and payload to the queue.
+// Returns error if a job with the same id is already pending.
+func (q *Queue) Enqueue(id string, payload []byte) error {
+	if id == "" {
+		return errors.New("job id must be present")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	} else if _, exists := q.entries[id]; exists {
+		return fmt.Errorf("job with id '%s' already exists", id)
+	}
+
+	e := &queueEntry{ID: id, Op: opEnqueue, Time: time.Now(), Payload: payload}
+	if err := q.append(e); err != nil {
+		return err
+	}
+	q.push(e)
+	q.notify()
+	return nil
+}
+
+// Lease blocks until a job is available or ctx is cancelled. The returned job
+// is invisible to other Lease calls until it is acked, nacked or its
+// visibility timeout expires. Job.Ack acks the job if the error is nil and
+// nacks it otherwise.
+func (q *Queue) Lease(ctx context.Context) (*Job, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrQueueClosed
+		}
+
+		e, wait := q.nextVisible(time.Now())
+		if e != nil {
+			job, err := q.lease(e)
+			q.mu.Unlock()
+			return job, err
+		}
+		wake := q.wake
+		q.mu.Unlock()
+
+		if err := waitFor(ctx, wake, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitFor blocks until ctx is cancelled, wake is closed or the wait duration
+// elapses. A zero wait duration waits without a timeout.
+func waitFor(ctx context.Context, wake <-chan struct{}, wait time.Duration) error {
+	var timeout <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wake:
+	case <-timeout:
+	}
+	return nil
+}
+
+// Ack durably removes the job from the queue.
+func (q *Queue) Ack(id string) error { return q.settle(id, 0, true) }
+
+// Nack makes a leased job available for lease again immediately.
+func (q *Queue) Nack(id string) error { return q.settle(id, 0, false) }
+
+// settle acks or nacks the job. If lease is not zero, the job is settled only
+// if it has not been leased again since.
+func (q *Queue) settle(id string, lease uint64, ack bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	e, found := q.entries[id]
+	if !found {
+		return fmt.Errorf("no pending job with id '%s'", id)
+	} else if lease != 0 && lease != e.lease {
+		return errStaleLease
+	}
+
+	if !ack {
+		e.leasedUntil = time.Time{}
+		q.notify()
+		return nil
+	}
+
+	if err := q.append(&queueEntry{ID: id, Op: opAck}); err != nil {
+		return err
+	}
+	e.acked = true
+	delete(q.entries, id)
+	delete(q.leased, id)
+
+	return q.maybeCompact()
+}
+
+// Len returns the number of jobs that are pending (including leased ones).
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Stream returns a Stream that leases jobs from the queue. Jobs are acked or
+// nacked in the queue based on the result passed to Job.Ack. A job leased
+// while the ctx is cancelled is nacked instead of being dropped.
+func (q *Queue) Stream(buffer int) Stream {
+	return func(ctx context.Context) (<-chan Job, error) {
+		ch := make(chan Job, buffer)
+
+		go func() {
+			defer close(ch)
+
+			for {
+				j, err := q.Lease(ctx)
+				if err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					j.Ack(ctx.Err())
+					return
+				case ch <- *j:
+				}
+			}
+		}()
+
+		return ch, nil
+	}
+}
+
+// Close closes the underlying log file. Jobs that are leased but not acked
+// will be available again when the queue is re-opened.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.notify()
+	return q.file.Close()
+}
+
+func (q *Queue) lease(e *queueEntry) (*Job, error) {
+	rec := &queueEntry{ID: e.ID, Op: opLease}
+	if err := q.append(rec); err != nil {
+		return nil, err
+	}
+
+	if q.head < len(q.order) && q.order[q.head] == e {
+		q.head++
+	}
+	q.leased[e.ID] = e
+
+	attempt := e.Attempt
+	e.Attempt++
+	e.lease++
+	e.leasedUntil = time.Now().Add(q.visibility)
+
+	id, lease := e.ID, e.lease
+	return &Job{
+		ID:      id,
+		Time:    e.Time,
+		Attempt: attempt,
+		Payload: e.Payload,
+		Ack: func(err error) {
+			if settleErr := q.settle(id, lease, err == nil); settleErr == errStaleLease {
+				q.Warnf("ignoring ack for job '%s': lease expired and job was leased again", id)
+			} else if settleErr != nil {
+				q.Errorf("failed to ack job '%s': %v", id, settleErr)
+			}
+		},
+	}, nil
+}
+
+// nextVisible returns the oldest entry that is not leased. Only the leased
+// entries (which are bounded by the number of consumers) and the head of the
+// order are checked. If there is none, returns the duration after which a
+// lease expires (zero if none leased).
+func (q *Queue) nextVisible(now time.Time) (*queueEntry, time.Duration) {
+	for q.head < len(q.order) && q.order[q.head].acked {
+		q.head++
+	}
+
+	var next *queueEntry
+	if q.head < len(q.order) {
+		next = q.order[q.head]
+	}
+
+	var wait time.Duration
+	for _, e := range q.leased {
+		if !e.leasedUntil.After(now) {
+			// expired or nacked.
+			if next == nil || e.seq < next.seq {
+				next = e
+			}
+			continue
+		}
+
+		if d := e.leasedUntil.Sub(now); wait == 0 || d < wait {
+			wait = d
+		}
+	}
+
+	if next != nil {
+		return next, 0
+	}
+	return nil, wait
+}
+
+// push adds the entry to the end of the FIFO order.
+func (q *Queue) push(e *queueEntry) {
+	q.seq++
+	e.seq = q.seq
+	q.entries[e.ID] = e
+	q.order = append(q.order, e)
+}
+
+// notify wakes up all the goroutines blocked in Lease.
+func (q *Queue) notify() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+func (q *Queue) append(e *queueEntry) error {
+	if err := writeRecord(q.file, e); err != nil {
+		return err
+	}
+	q.records++
+	return q.file.Sync()
+}
+
+// maybeCompact rewrites the log with only the pending jobs once it has grown
+// much larger than the live set. The order is trimmed along with the log.
+func (q *Queue) maybeCompact() error {
+	if q.records < compactAfter || q.records < 4*len(q.entries) {
+		return nil
+	}
+
+	var live []*queueEntry
+	for _, e := range q.leased {
+		live = append(live, e)
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].seq < live[j].seq })
+
+	var unleased []*queueEntry
+	for _, e := range q.order[q.head:] {
+		if !e.acked {
+			unleased = append(unleased, e)
+		}
+	}
+	live = append(live, unleased...)
+
+	tmpPath := q.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range live {
+		if err := writeRecord(tmp, e); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	_ = tmp.Close()
+
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(q.path))
+
+	f, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_ = q.file.Close()
+	q.file = f
+	q.records = len(live)
+	q.order, q.head = unleased, 0
+	return nil
+}
+
+// recover replays the log to rebuild the queue state. A partially written
+// record at the end of the log (e.g., due to a crash) is truncated.
+func (q *Queue) recover() error {
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if err := f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		offset += int64(n)
+		q.records++
+
+		switch rec.Op {
+		case opEnqueue:
+			q.push(rec)
+
+		case opLease:
+			if e, found := q.entries[rec.ID]; found {
+				e.Attempt++
+			}
+
+		case opAck:
+			if e, found := q.entries[rec.ID]; found {
+				e.acked = true
+				delete(q.entries, rec.ID)
+			}
+		}
+	}
+
+	live := q.order[:0]
+	for _, e := range q.order {
+		if !e.acked {
+			live = append(live, e)
+		}
+	}
+	q.order = live
+	return nil
+}
+
+func writeRecord(w io.Writer, e *queueEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, recHeaderSz+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	copy(buf[recHeaderSz:], data)
+
+	_, err = w.Write(buf)
+	return err
+}
+
+func readRecord(r io.Reader) (*queueEntry, int, error) {
+	var header [recHeaderSz]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, 0, errors.New("truncated record header")
+		}
+		return nil, 0, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > maxRecordSz {
+		return nil, 0, errors.New("record too large")
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, errors.New("truncated record")
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+
+	var e queueEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, 0, err
+	}
+	return &e, recHeaderSz + len(data), nil
+}
+
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spy16/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.q")
+	ctx := context.Background()
+
+	q, err := OpenQueue(path, 50*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue("1", []byte("one")))
+	require.NoError(t, q.Enqueue("2", []byte("two")))
+	require.NoError(t, q.Enqueue("3", []byte("three")))
+	assert.Error(t, q.Enqueue("1", nil))
+
+	j1, err := q.Lease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", j1.ID)
+	assert.Equal(t, []byte("one"), j1.Payload)
+	j1.Ack(nil)
+
+	j2, err := q.Lease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", j2.ID)
+	j2.Ack(errors.New("failed"))
+
+	j2, err = q.Lease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", j2.ID)
+	assert.Equal(t, 1, j2.Attempt)
+
+	// not acked. must become visible again after the timeout.
+	j3, err := q.Lease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "3", j3.ID)
+
+	j2, err = q.Lease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", j2.ID)
+	assert.Equal(t, 2, j2.Attempt)
+	require.NoError(t, q.Close())
+
+	// simulate a crash in the middle of a write.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0x00, 0x00})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = OpenQueue(path, time.Second)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, 2, q.Len())
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	var ids []string
+	summary, err := Run(ctx, mustStream(t, ctx, q.Stream(0)), WithProc(ProcFn(func(_ context.Context, job Job) error {
+		ids = append(ids, job.ID)
+		return nil
+	}), 1))
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Processed)
+	assert.Equal(t, []string{"2", "3"}, ids)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestQueue_StaleLease(t *testing.T) {
+	q, err := OpenQueue(filepath.Join(t.TempDir(), "jobs.q"), 20*time.Millisecond)
+	require.NoError(t, err)
+	defer q.Close()
+	q.Logger = log.NoOpLogger{}
+
+	require.NoError(t, q.Enqueue("1", []byte("one")))
+
+	first, err := q.Lease(context.Background())
+	require.NoError(t, err)
+
+	// lease expires and the job is leased again.
+	second, err := q.Lease(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1", second.ID)
+	assert.Equal(t, 1, second.Attempt)
+
+	// the first holder must not be able to settle the new lease.
+	first.Ack(errors.New("failed"))
+	first.Ack(nil)
+	assert.Equal(t, 1, q.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = q.Lease(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err, "job must stay leased by the second holder")
+
+	second.Ack(nil)
+	assert.Equal(t, 0, q.Len())
+}
+
+func mustStream(t *testing.T, ctx context.Context, stream Stream) <-chan Job {
+	ch, err := stream(ctx)
+	require.NoError(t, err)
+	return ch
+}
+
+func TestQueue_Backlog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.q")
+	ctx := context.Background()
+
+	q, err := OpenQueue(path, time.Minute)
+	require.NoError(t, err)
+	q.Logger = log.NoOpLogger{}
+
+	n := 3 * compactAfter
+	for i := 0; i < n; i++ {
+		require.NoError(t, q.Enqueue(fmt.Sprintf("%d", i), nil))
+	}
+
+	// an early job is nacked and must be redelivered before the later ones.
+	first, err := q.Lease(ctx)
+	require.NoError(t, err)
+	second, err := q.Lease(ctx)
+	require.NoError(t, err)
+	first.Ack(errors.New("failed"))
+	second.Ack(nil)
+
+	for i := 0; i < n-2; i++ {
+		j, err := q.Lease(ctx)
+		require.NoError(t, err)
+		if i == 0 {
+			assert.Equal(t, "0", j.ID, "nacked job must be leased first")
+		}
+		j.Ack(nil)
+	}
+
+	q.mu.Lock()
+	assert.True(t, len(q.order) < compactAfter, "order must be trimmed on compaction, got %d", len(q.order))
+	assert.Empty(t, q.leased)
+	q.mu.Unlock()
+
+	last, err := q.Lease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%d", n-1), last.ID)
+	require.NoError(t, q.Close())
+
+	// the leased job survives the compaction and a restart.
+	q, err = OpenQueue(path, time.Minute)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, 1, q.Len())
+
+	j, err := q.Lease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, last.ID, j.ID)
+	assert.Equal(t, 1, j.Attempt)
+}
+
+func TestQueue_StreamCancelNacks(t *testing.T) {
+	q, err := OpenQueue(filepath.Join(t.TempDir(), "jobs.q"), time.Minute)
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.Enqueue("1", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = q.Stream(0)(ctx)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.leased) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+
+	// without the nack, the job would be invisible for the whole minute.
+	leaseCtx, cancelLease := context.WithTimeout(context.Background(), time.Second)
+	defer cancelLease()
+	j, err := q.Lease(leaseCtx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", j.ID)
+}
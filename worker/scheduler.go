@@ -0,0 +1,346 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spy16/pkg/log"
+)
+
+// OverlapPolicy decides what happens when a scheduled job is due while the
+// previous run of the same job is still in progress.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the new run if the previous run is in progress.
+	OverlapSkip OverlapPolicy = iota
+
+	// OverlapQueue defers the new run until the previous run finishes.
+	OverlapQueue
+
+	// OverlapCancel cancels the context of the previous run and emits the
+	// new run immediately.
+	OverlapCancel
+)
+
+// ScheduleOption can be passed to Scheduler.Cron and Scheduler.After to
+// customise the scheduling behaviour.
+type ScheduleOption func(e *scheduled)
+
+// Jitter delays each run by a random duration in the range [0, max). This
+// helps avoid thundering herds when many jobs share the same schedule.
+func Jitter(max time.Duration) ScheduleOption {
+	return func(e *scheduled) { e.jitter = max }
+}
+
+// OnOverlap sets the policy to be applied when a run is due while the
+// previous run is still in progress. Defaults to OverlapSkip.
+func OnOverlap(policy OverlapPolicy) ScheduleOption {
+	return func(e *scheduled) { e.overlap = policy }
+}
+
+// NewScheduler returns a new Scheduler. If statePath is not empty, the next
+// fire times of all the scheduled jobs are persisted to that file so that
+// runs missed while the process was down are caught up (once per job) after
+// a restart.
+func NewScheduler(statePath string) (*Scheduler, error) {
+	s := &Scheduler{
+		Logger:    log.StdLogger{},
+		statePath: statePath,
+		entries:   map[string]*scheduled{},
+		persisted: map[string]time.Time{},
+		wake:      make(chan struct{}),
+	}
+
+	if statePath != "" {
+		data, err := ioutil.ReadFile(statePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		} else if err == nil {
+			if err := json.Unmarshal(data, &s.persisted); err != nil {
+				return nil, fmt.Errorf("failed to read scheduler state: %v", err)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Scheduler emits Jobs at scheduled times into a Stream. Each emitted Job has
+// the scheduled run time as Time and the registered value as Payload.
+type Scheduler struct {
+	log.Logger
+
+	mu        sync.Mutex
+	statePath string
+	entries   map[string]*scheduled
+	persisted map[string]time.Time
+	wake      chan struct{}
+}
+
+type scheduled struct {
+	name    string
+	sched   Schedule // nil for one-off jobs.
+	payload interface{}
+	jitter  time.Duration
+	overlap OverlapPolicy
+
+	next    time.Time // planned time of next run.
+	fireAt  time.Time // next with jitter applied.
+	running int
+	queued  []time.Time // planned times of runs deferred by OverlapQueue.
+	cancel  context.CancelFunc
+}
+
+// Cron registers a job to be run as per the cron spec. See ParseCron for the
+// supported spec format. Registering with an existing name replaces the job.
+func (s *Scheduler) Cron(name, spec string, payload interface{}, opts ...ScheduleOption) error {
+	sched, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	return s.add(name, sched, payload, time.Now(), opts)
+}
+
+// After registers a one-off job to be run once after the given delay. If the
+// scheduler state already has a pending run for the name, that run time is
+// retained instead.
+func (s *Scheduler) After(name string, delay time.Duration, payload interface{}, opts ...ScheduleOption) error {
+	return s.add(name, nil, payload, time.Now().Add(delay), opts)
+}
+
+// Remove un-registers the job with the given name. In-progress runs are not
+// affected.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, name)
+	delete(s.persisted, name)
+	s.notify()
+	return s.saveState()
+}
+
+// Stream returns a Stream that emits the scheduled jobs as they become due.
+// Only one stream should be consumed per Scheduler.
+func (s *Scheduler) Stream(buffer int) Stream {
+	return func(ctx context.Context) (<-chan Job, error) {
+		ch := make(chan Job, buffer)
+		go func() {
+			defer close(ch)
+			s.run(ctx, ch)
+
+			// jobs still in the buffer will not be consumed. release them
+			// so that they do not count as running.
+			for {
+				select {
+				case job := <-ch:
+					job.Ack(ctx.Err())
+				default:
+					return
+				}
+			}
+		}()
+		return ch, nil
+	}
+}
+
+func (s *Scheduler) add(name string, sched Schedule, payload interface{}, first time.Time, opts []ScheduleOption) error {
+	if name == "" {
+		return fmt.Errorf("schedule name must not be empty")
+	}
+
+	e := &scheduled{name: name, sched: sched, payload: payload}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, found := s.persisted[name]; found {
+		// due time from the previous process. if this is in the past, the
+		// job will fire immediately to catch up.
+		e.next, e.fireAt = t, t
+	} else {
+		if sched != nil {
+			first = sched.Next(first)
+			if first.IsZero() {
+				return fmt.Errorf("schedule for '%s' never fires", name)
+			}
+		}
+		e.next = first
+		e.fireAt = first.Add(e.randJitter())
+	}
+
+	if prev, found := s.entries[name]; found {
+		e.running, e.queued, e.cancel = prev.running, prev.queued, prev.cancel
+	}
+	s.entries[name] = e
+	s.notify()
+	return s.saveState()
+}
+
+func (s *Scheduler) run(ctx context.Context, ch chan<- Job) {
+	for {
+		jobs, wait, wake := s.collectDue(time.Now())
+
+		for i, job := range jobs {
+			select {
+			case <-ctx.Done():
+				for _, undelivered := range jobs[i:] {
+					undelivered.Ack(ctx.Err())
+				}
+				return
+			case ch <- job:
+			}
+		}
+
+		if len(jobs) > 0 {
+			continue
+		}
+
+		if err := waitFor(ctx, wake, wait); err != nil {
+			return
+		}
+	}
+}
+
+// collectDue returns the jobs to be emitted now and the duration until the
+// next job is due (zero if nothing is scheduled).
+func (s *Scheduler) collectDue(now time.Time) ([]Job, time.Duration, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []Job
+	var wait time.Duration
+	dirty := false
+	for name, e := range s.entries {
+		if len(e.queued) > 0 && e.running == 0 {
+			planned := e.queued[0]
+			e.queued = e.queued[1:]
+			jobs = append(jobs, s.newJob(e, planned))
+		}
+
+		if e.fireAt.After(now) {
+			if d := e.fireAt.Sub(now); wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		planned := e.next
+		dirty = true
+		if e.sched == nil {
+			delete(s.entries, name)
+			delete(s.persisted, name)
+		} else {
+			// missed runs are coalesced into one by computing from now.
+			e.next = e.sched.Next(now)
+			e.fireAt = e.next.Add(e.randJitter())
+			if e.next.IsZero() {
+				delete(s.entries, name)
+				delete(s.persisted, name)
+			} else if d := e.fireAt.Sub(now); wait == 0 || d < wait {
+				wait = d
+			}
+		}
+
+		if e.running > 0 {
+			switch e.overlap {
+			case OverlapSkip:
+				s.Warnf("skipping run of '%s' at %s: previous run in progress", name, planned)
+				continue
+
+			case OverlapQueue:
+				e.queued = append(e.queued, planned)
+				continue
+
+			case OverlapCancel:
+				s.Warnf("cancelling previous run of '%s'", name)
+				e.cancel()
+			}
+		}
+		jobs = append(jobs, s.newJob(e, planned))
+	}
+
+	if dirty {
+		if err := s.saveState(); err != nil {
+			s.Errorf("failed to persist scheduler state: %v", err)
+		}
+	}
+
+	return jobs, wait, s.wake
+}
+
+func (s *Scheduler) newJob(e *scheduled, planned time.Time) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.running++
+	e.cancel = cancel
+
+	var once sync.Once
+	return Job{
+		ID:      fmt.Sprintf("%s-%d", e.name, planned.Unix()),
+		Time:    planned,
+		Payload: e.payload,
+		ctx:     ctx,
+		Ack: func(_ error) {
+			once.Do(func() {
+				cancel()
+
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				e.running--
+				s.notify()
+			})
+		},
+	}
+}
+
+// saveState writes the next fire times to the state file. Must be called
+// with the lock held.
+func (s *Scheduler) saveState() error {
+	if s.statePath == "" {
+		return nil
+	}
+
+	// entries not registered (yet) in this process are retained so that
+	// they can still be caught up once registered.
+	state := map[string]time.Time{}
+	for name, t := range s.persisted {
+		state[name] = t
+	}
+	for name, e := range s.entries {
+		state[name] = e.next
+	}
+	s.persisted = state
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.statePath)
+}
+
+func (s *Scheduler) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+func (e *scheduled) randJitter() time.Duration {
+	if e.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(e.jitter)))
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spy16/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var schedBase = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestScheduler_Overlap(t *testing.T) {
+	at := func(minutes int) time.Time { return schedBase.Add(time.Duration(minutes) * time.Minute) }
+
+	t.Run("Skip", func(t *testing.T) {
+		s := newTestScheduler(t, "")
+		require.NoError(t, s.add("job", Every(time.Minute), nil, at(0), []ScheduleOption{OnOverlap(OverlapSkip)}))
+
+		first := mustCollect(t, s, at(1), 1)[0]
+		assert.True(t, first.Time.Equal(at(1)))
+		mustCollect(t, s, at(2), 0)
+
+		first.Ack(nil)
+		next := mustCollect(t, s, at(3), 1)[0]
+		assert.True(t, next.Time.Equal(at(3)))
+	})
+
+	t.Run("Queue", func(t *testing.T) {
+		s := newTestScheduler(t, "")
+		require.NoError(t, s.add("job", Every(time.Minute), nil, at(0), []ScheduleOption{OnOverlap(OverlapQueue)}))
+
+		first := mustCollect(t, s, at(1), 1)[0]
+		mustCollect(t, s, at(2), 0)
+
+		first.Ack(nil)
+		queued := mustCollect(t, s, at(2).Add(time.Second), 1)[0]
+		assert.True(t, queued.Time.Equal(at(2)), "queued run must keep its planned time, got %s", queued.Time)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		s := newTestScheduler(t, "")
+		require.NoError(t, s.add("job", Every(time.Minute), nil, at(0), []ScheduleOption{OnOverlap(OverlapCancel)}))
+
+		first := mustCollect(t, s, at(1), 1)[0]
+		second := mustCollect(t, s, at(2), 1)[0]
+		assert.Error(t, first.ctx.Err(), "previous run must be cancelled")
+		assert.NoError(t, second.ctx.Err())
+	})
+}
+
+func TestScheduler_CatchUp(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "schedule.json")
+
+	s := newTestScheduler(t, statePath)
+	require.NoError(t, s.add("job", Every(time.Hour), "payload", schedBase, nil))
+
+	// process restarts after missing several runs.
+	s = newTestScheduler(t, statePath)
+	now := schedBase.Add(5*time.Hour + 30*time.Minute)
+	require.NoError(t, s.add("job", Every(time.Hour), "payload", now, nil))
+
+	missed := mustCollect(t, s, now, 1)[0]
+	assert.True(t, missed.Time.Equal(schedBase.Add(time.Hour)), "expected first missed run, got %s", missed.Time)
+	assert.Equal(t, "payload", missed.Payload)
+	missed.Ack(nil)
+
+	// missed runs are coalesced into one and the schedule resumes from now.
+	mustCollect(t, s, now, 0)
+	next := mustCollect(t, s, now.Add(time.Hour), 1)[0]
+	assert.True(t, next.Time.Equal(now.Add(time.Hour)))
+}
+
+func TestScheduler_After(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "schedule.json")
+
+	s := newTestScheduler(t, statePath)
+	require.NoError(t, s.add("once", nil, "payload", schedBase.Add(5*time.Second), nil))
+
+	_, wait, _ := s.collectDue(schedBase)
+	assert.Equal(t, 5*time.Second, wait)
+
+	job := mustCollect(t, s, schedBase.Add(5*time.Second), 1)[0]
+	assert.Equal(t, "payload", job.Payload)
+	job.Ack(nil)
+	mustCollect(t, s, schedBase.Add(time.Hour), 0)
+
+	// fired one-offs must not be caught up after a restart.
+	s = newTestScheduler(t, statePath)
+	assert.Empty(t, s.persisted)
+}
+
+func TestScheduler_StreamStopped(t *testing.T) {
+	for _, buffer := range []int{0, 1} {
+		t.Run(fmt.Sprintf("Buffer%d", buffer), func(t *testing.T) {
+			s := newTestScheduler(t, "")
+			require.NoError(t, s.add("job", Every(time.Minute), nil, time.Now().Add(-2*time.Minute),
+				[]ScheduleOption{OnOverlap(OverlapSkip)}))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			_, err := s.Stream(buffer)(ctx)
+			require.NoError(t, err)
+
+			running := func() int {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				return s.entries["job"].running
+			}
+			require.Eventually(t, func() bool { return running() == 1 }, time.Second, time.Millisecond)
+
+			// the job is never consumed and must be released once the
+			// stream stops, or the skip policy would block all later runs.
+			cancel()
+			assert.Eventually(t, func() bool { return running() == 0 }, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func newTestScheduler(t *testing.T, statePath string) *Scheduler {
+	s, err := NewScheduler(statePath)
+	require.NoError(t, err)
+	s.Logger = log.NoOpLogger{}
+	return s
+}
+
+func mustCollect(t *testing.T, s *Scheduler, now time.Time, n int) []Job {
+	jobs, _, _ := s.collectDue(now)
+	require.Len(t, jobs, n, "jobs due at %s", now)
+	return jobs
+}
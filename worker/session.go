@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/spy16/pkg/log"
 )
@@ -11,57 +13,307 @@ import (
 type workerSession struct {
 	log.Logger
 
-	proc     Proc
-	workers  int
-	OnFinish func(job Job)
+	proc         Proc
+	metrics      Metrics
+	workers      int
+	jobTimeout   time.Duration
+	softDeadline time.Duration
+	onOverdue    func(job Job, elapsed time.Duration)
+	drain        bool
+	drainGrace   time.Duration
+	handOff      func(job Job)
+	scaler       *scaler
+	keyFn        KeyFunc
+	limiters     []limiter
+	middlewares  []Middleware
+	batchProc    BatchProc
+	batchSize    int
+	batchWait    time.Duration
+	closed       chan struct{}
+	closeOnce    sync.Once
+	OnFinish     func(job Job)
+
+	stats struct {
+		active, inFlight, processed, failed int64
+		abandoned, nacked, handedOff        int64
+		rejected                            int64
+	}
 }
 
 // Run spawns the workers to consume from the stream and executed the
 // registered proc.
-func (ws *workerSession) Run(ctx context.Context, stream <-chan Job) error {
+func (ws *workerSession) Run(ctx context.Context, stream <-chan Job) (Summary, error) {
 	if err := ws.init(); err != nil {
-		return err
+		return Summary{}, err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	jobCtx, cancelJobs := ws.jobContext(ctx)
+	defer cancelJobs()
+
+	var nextID int64
 	wg := &sync.WaitGroup{}
-	for i := 0; i < ws.workers; i++ {
+	spawnOn := func(src <-chan Job) {
 		wg.Add(1)
-		go func(id int) {
+		if ws.scaler != nil {
+			ws.scaler.grew()
+		}
+
+		go func(id int64) {
 			defer wg.Done()
-			if err := ws.worker(ctx, stream); err != nil {
+			ws.metrics.WorkersActive(int(atomic.AddInt64(&ws.stats.active, 1)))
+			defer func() {
+				ws.metrics.WorkersActive(int(atomic.AddInt64(&ws.stats.active, -1)))
+			}()
+
+			run := ws.worker
+			if ws.batchProc != nil {
+				run = ws.batchWorker
+			}
+
+			err := run(ctx, jobCtx, src)
+			if ws.scaler != nil && err != errRetired {
+				// retired workers are already removed from the pool.
+				ws.scaler.shrunk()
+			}
+			if err != nil {
 				ws.Debugf("worker-%d exited (cause: %s)", id, err)
 			}
-		}(i)
+		}(atomic.AddInt64(&nextID, 1) - 1)
+	}
+	spawn := func() { spawnOn(stream) }
+
+	var lanes []chan Job
+	if ws.keyFn != nil {
+		lanes = ws.partition(ctx, stream, wg)
+		for _, lane := range lanes {
+			spawnOn(lane)
+		}
+	} else {
+		for i := 0; i < ws.workers; i++ {
+			spawn()
+		}
+	}
+
+	if ws.scaler != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws.autoScale(ctx, stream, spawn)
+		}()
 	}
 	wg.Wait()
 
-	return nil
+	if ws.drain {
+		for _, lane := range lanes {
+			ws.drainBuffered(lane)
+		}
+		ws.drainBuffered(stream)
+	}
+
+	return ws.summary(), nil
+}
+
+// jobContext returns the context to be used for executing jobs. Without
+// drain mode, jobs are cancelled along with the session. In drain mode, the
+// in-flight jobs get a grace period after the session context is cancelled.
+func (ws *workerSession) jobContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if !ws.drain {
+		return ctx, func() {}
+	}
+
+	jobCtx, cancelJobs := context.WithCancel(detachedCtx{Context: ctx})
+	go func() {
+		select {
+		case <-jobCtx.Done():
+			return
+		case <-ctx.Done():
+		}
+
+		t := time.NewTimer(ws.drainGrace)
+		defer t.Stop()
+
+		select {
+		case <-jobCtx.Done():
+		case <-t.C:
+			if n := atomic.LoadInt64(&ws.stats.inFlight); n > 0 {
+				ws.Warnf("grace period expired, cancelling %d in-flight job(s)", n)
+				atomic.StoreInt64(&ws.stats.abandoned, n)
+			}
+			cancelJobs()
+		}
+	}()
+	return jobCtx, cancelJobs
 }
 
-func (ws *workerSession) worker(ctx context.Context, ch <-chan Job) error {
+func (ws *workerSession) worker(ctx, jobCtx context.Context, ch <-chan Job) error {
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if ws.scaler != nil {
+		idleTimer = time.NewTimer(ws.scaler.cfg.Cooldown)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 
+		case <-idle:
+			if ws.scaler.tryRetire() {
+				return errRetired
+			}
+			idleTimer.Reset(ws.scaler.cfg.Cooldown)
+
 		case j, ok := <-ch:
 			if !ok {
+				ws.streamClosed()
 				return errors.New("stream closed")
 			}
 
-			ws.processOne(ctx, j)
+			if ws.drain && ctx.Err() != nil {
+				// picked up after shutdown began. must not be executed.
+				ws.drainOne(j)
+				return ctx.Err()
+			}
+
+			ws.processOne(jobCtx, j)
+
+			if idleTimer != nil {
+				if !idleTimer.Stop() {
+					select {
+					case <-idleTimer.C:
+					default:
+					}
+				}
+				idleTimer.Reset(ws.scaler.cfg.Cooldown)
+			}
+		}
+	}
+}
+
+// autoScale periodically evaluates the backlog and latency and spawns new
+// workers as needed. Returns when ctx is cancelled or the stream is closed.
+func (ws *workerSession) autoScale(ctx context.Context, stream <-chan Job, spawn func()) {
+	ticker := time.NewTicker(ws.scaler.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ws.closed:
+			return
+
+		case <-ticker.C:
+			n := ws.scaler.scaleBy(len(stream))
+			if n > 0 {
+				ws.Debugf("scaling up by %d worker(s) (backlog=%d)", n, len(stream))
+			}
+			for i := 0; i < n; i++ {
+				spawn()
+			}
 		}
 	}
 }
 
+func (ws *workerSession) streamClosed() {
+	ws.closeOnce.Do(func() { close(ws.closed) })
+}
+
+// drainBuffered releases the jobs that are still buffered in the stream
+// without executing them.
+func (ws *workerSession) drainBuffered(ch <-chan Job) {
+	for {
+		select {
+		case j, ok := <-ch:
+			if !ok {
+				return
+			}
+			ws.drainOne(j)
+
+		default:
+			return
+		}
+	}
+}
+
+func (ws *workerSession) drainOne(job Job) {
+	if ws.handOff != nil {
+		ws.handOff(job)
+		atomic.AddInt64(&ws.stats.handedOff, 1)
+		return
+	}
+
+	job.Error = ErrDrained
+	if job.Ack != nil {
+		job.Ack(ErrDrained)
+	}
+	atomic.AddInt64(&ws.stats.nacked, 1)
+}
+
+func (ws *workerSession) summary() Summary {
+	return Summary{
+		Processed: int(atomic.LoadInt64(&ws.stats.processed)),
+		Failed:    int(atomic.LoadInt64(&ws.stats.failed)),
+		Rejected:  int(atomic.LoadInt64(&ws.stats.rejected)),
+		Abandoned: int(atomic.LoadInt64(&ws.stats.abandoned)),
+		Nacked:    int(atomic.LoadInt64(&ws.stats.nacked)),
+		HandedOff: int(atomic.LoadInt64(&ws.stats.handedOff)),
+	}
+}
+
 func (ws *workerSession) processOne(ctx context.Context, job Job) {
-	// TODO: collect metrics?
-	err := ws.proc.Exec(ctx, job)
+	if job.ctx != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = mergeCancel(ctx, job.ctx)
+		defer cancel()
+	}
+
+	release, err := ws.acquire(ctx, job)
+	if err != nil {
+		ws.reject(job, err)
+		return
+	}
+	defer release()
+
+	if ws.jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.jobTimeout)
+		defer cancel()
+	}
+
+	var lag time.Duration
+	if !job.Time.IsZero() {
+		lag = time.Since(job.Time)
+	}
+	ws.metrics.JobStarted(job, lag)
+
+	atomic.AddInt64(&ws.stats.inFlight, 1)
+	start := time.Now()
+	stopWatch := ws.watch(job)
+	err = ws.exec(ctx, job)
+	stopWatch()
+	atomic.AddInt64(&ws.stats.inFlight, -1)
+
+	latency := time.Since(start)
+	ws.metrics.JobFinished(job, latency, err)
+	if ws.scaler != nil {
+		ws.scaler.observe(latency)
+	}
+
+	ws.finish(job, err)
+}
+
+func (ws *workerSession) finish(job Job, err error) {
+	atomic.AddInt64(&ws.stats.processed, 1)
 	if err != nil {
 		job.Error = err
+		atomic.AddInt64(&ws.stats.failed, 1)
 	}
 	ws.OnFinish(job)
 	if job.Ack != nil {
@@ -69,14 +321,100 @@ func (ws *workerSession) processOne(ctx context.Context, job Job) {
 	}
 }
 
+// reject acks the job with err without counting it as processed. Used for
+// jobs that never reach the proc (e.g., a limiter could not be acquired).
+func (ws *workerSession) reject(job Job, err error) {
+	atomic.AddInt64(&ws.stats.rejected, 1)
+	job.Error = err
+	ws.OnFinish(job)
+	if job.Ack != nil {
+		job.Ack(err)
+	}
+}
+
+// exec invokes the proc and converts any panic into a PanicError so that a
+// misbehaving proc cannot bring down the entire process.
+func (ws *workerSession) exec(ctx context.Context, job Job) error {
+	return safeExec(ctx, ws.proc, job, func(pe *PanicError) {
+		ws.Errorf("proc panicked on job '%s': %v\n%s", job.ID, pe.Value, pe.Stack)
+	})
+}
+
+// watch arms the watchdog for the job if a soft-deadline is configured. The
+// returned func must be called once the job finishes.
+func (ws *workerSession) watch(job Job) (stop func()) {
+	if ws.softDeadline <= 0 {
+		return func() {}
+	}
+
+	start := time.Now()
+	t := time.AfterFunc(ws.softDeadline, func() {
+		elapsed := time.Since(start)
+		ws.Warnf("job '%s' exceeded soft deadline (elapsed=%s, deadline=%s)",
+			job.ID, elapsed, ws.softDeadline)
+		if ws.onOverdue != nil {
+			ws.onOverdue(job, elapsed)
+		}
+	})
+	return func() { t.Stop() }
+}
+
 func (ws *workerSession) init() error {
 	if ws.proc == nil {
 		ws.proc = noOpProc
 	}
+	ws.proc = Chain(ws.middlewares...)(ws.proc)
+
+	if ws.metrics == nil {
+		ws.metrics = noOpMetrics{}
+	}
 
 	if ws.workers <= 0 {
 		ws.workers = 1
 	}
 
+	if ws.scaler != nil && ws.keyFn != nil {
+		return errors.New("autoscaling cannot be used with keyed ordering")
+	}
+
+	if ws.batchProc != nil && (ws.scaler != nil || len(ws.limiters) > 0) {
+		return errors.New("autoscaling and limits cannot be used with batch processing")
+	}
+
+	if ws.batchProc != nil && len(ws.middlewares) > 0 {
+		return errors.New("middlewares cannot be used with batch processing")
+	}
+
+	if ws.scaler != nil {
+		ws.workers = ws.scaler.cfg.Min
+	}
+	ws.closed = make(chan struct{})
+
+	if ws.OnFinish == nil {
+		ws.OnFinish = func(_ Job) { /* do nothing */ }
+	}
+
 	return nil
 }
+
+// mergeCancel returns a child of ctx that is also cancelled when other is
+// cancelled.
+func mergeCancel(ctx, other context.Context) (context.Context, context.CancelFunc) {
+	merged, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-other.Done():
+			cancel()
+		case <-merged.Done():
+		}
+	}()
+	return merged, cancel
+}
+
+// detachedCtx carries the values of the parent context but is never
+// cancelled along with it.
+type detachedCtx struct{ context.Context }
+
+func (detachedCtx) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedCtx) Done() <-chan struct{}       { return nil }
+func (detachedCtx) Err() error                  { return nil }
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spy16/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_PanicRecovery(t *testing.T) {
+	proc := ProcFn(func(_ context.Context, job Job) error {
+		if job.ID == "bad" {
+			panic("boom")
+		}
+		return nil
+	})
+
+	jobs, acks := ackedJobs("bad", "good")
+	summary, err := Run(context.Background(), jobs, WithProc(proc, 1), WithLogger(log.NoOpLogger{}))
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Processed: 2, Failed: 1}, summary)
+
+	var pe *PanicError
+	require.True(t, errors.As(acks.get("bad"), &pe), "expected *PanicError, got %v", acks.get("bad"))
+	assert.Equal(t, "boom", pe.Value)
+	assert.NotEmpty(t, pe.Stack)
+	assert.NoError(t, acks.get("good"))
+}
+
+func TestRun_JobTimeout(t *testing.T) {
+	proc := ProcFn(func(ctx context.Context, _ Job) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+
+	jobs, acks := ackedJobs("slow")
+	_, err := Run(context.Background(), jobs, WithProc(proc, 1), WithJobTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, context.DeadlineExceeded, acks.get("slow"))
+}
+
+func TestRun_Watchdog(t *testing.T) {
+	proc := ProcFn(func(_ context.Context, job Job) error {
+		if job.ID == "slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	})
+
+	var mu sync.Mutex
+	var overdue []string
+	onOverdue := func(job Job, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.True(t, elapsed >= 10*time.Millisecond)
+		overdue = append(overdue, job.ID)
+	}
+
+	jobs, acks := ackedJobs("slow", "fast")
+	_, err := Run(context.Background(), jobs, WithProc(proc, 1),
+		WithLogger(log.NoOpLogger{}), WithWatchdog(10*time.Millisecond, onOverdue))
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"slow"}, overdue)
+	assert.NoError(t, acks.get("slow"), "watchdog must not interrupt the job")
+}
+
+func TestRun_Drain(t *testing.T) {
+	t.Run("Nack", func(t *testing.T) {
+		summary, acks := runDrained(t, 10*time.Millisecond, time.Second, nil)
+		assert.Equal(t, Summary{Processed: 1, Nacked: 4}, summary)
+
+		assert.NoError(t, acks.get("0"), "in-flight job must finish within grace period")
+		for _, id := range []string{"1", "2", "3", "4"} {
+			assert.Equal(t, ErrDrained, acks.get(id))
+		}
+	})
+
+	t.Run("HandOff", func(t *testing.T) {
+		var mu sync.Mutex
+		var handedOff []string
+		summary, _ := runDrained(t, 10*time.Millisecond, time.Second, func(job Job) {
+			mu.Lock()
+			defer mu.Unlock()
+			handedOff = append(handedOff, job.ID)
+		})
+		assert.Equal(t, Summary{Processed: 1, HandedOff: 4}, summary)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.ElementsMatch(t, []string{"1", "2", "3", "4"}, handedOff)
+	})
+
+	t.Run("GraceExpiry", func(t *testing.T) {
+		summary, acks := runDrained(t, time.Minute, 20*time.Millisecond, nil)
+		assert.Equal(t, Summary{Processed: 1, Failed: 1, Abandoned: 1, Nacked: 4}, summary)
+		assert.Equal(t, context.Canceled, acks.get("0"))
+	})
+}
+
+// runDrained runs a drain mode session with 5 buffered jobs. The session is
+// cancelled once the first job starts, which then takes jobDuration unless
+// its context is cancelled.
+func runDrained(t *testing.T, jobDuration, grace time.Duration, handOff func(job Job)) (Summary, *ackRecord) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := make(chan Job, 5)
+	rec := &ackRecord{errs: map[string]error{}}
+	for _, id := range []string{"0", "1", "2", "3", "4"} {
+		stream <- rec.job(id)
+	}
+
+	proc := ProcFn(func(jobCtx context.Context, _ Job) error {
+		cancel()
+		select {
+		case <-jobCtx.Done():
+			return jobCtx.Err()
+		case <-time.After(jobDuration):
+			return nil
+		}
+	})
+
+	summary, err := Run(ctx, stream, WithProc(proc, 1),
+		WithLogger(log.NoOpLogger{}), WithDrain(grace, handOff))
+	require.NoError(t, err)
+	return summary, rec
+}
+
+// ackedJobs returns a closed channel with jobs for the ids and a record of
+// the errors they are acked with.
+func ackedJobs(ids ...string) (<-chan Job, *ackRecord) {
+	rec := &ackRecord{errs: map[string]error{}}
+	ch := make(chan Job, len(ids))
+	for _, id := range ids {
+		ch <- rec.job(id)
+	}
+	close(ch)
+	return ch, rec
+}
+
+type ackRecord struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func (r *ackRecord) job(id string) Job {
+	return Job{ID: id, Payload: id, Ack: func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, found := r.errs[id]; found {
+			panic(fmt.Sprintf("job '%s' acked twice", id))
+		}
+		r.errs[id] = err
+	}}
+}
+
+func (r *ackRecord) get(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.errs[id]
+}
@@ -2,19 +2,37 @@ package worker
 
 import (
 	"context"
+	"errors"
 )
 
+// ErrDrained is used to Nack the jobs that were left unprocessed in the
+// stream when a session in drain mode shuts down.
+var ErrDrained = errors.New("job not processed: worker is draining")
+
+var errRetired = errors.New("retired after being idle")
+
 // Run starts a worker and runs until context is cancelled or stream returns io.EOF.
-func Run(ctx context.Context, stream <-chan Job, opts ...Option) error {
+// The returned Summary reports what happened to the jobs consumed in the session.
+func Run(ctx context.Context, stream <-chan Job, opts ...Option) (Summary, error) {
 	ws := workerSession{}
 	for _, opt := range withDefaults(opts) {
 		if err := opt(&ws); err != nil {
-			return err
+			return Summary{}, err
 		}
 	}
 	return ws.Run(ctx, stream)
 }
 
+// Summary reports the outcome of a worker session.
+type Summary struct {
+	Processed int // jobs executed by the proc (irrespective of the result).
+	Failed    int // jobs for which the proc returned an error.
+	Rejected  int // jobs acked with an error before reaching the proc.
+	Abandoned int // in-flight jobs cancelled after the drain grace period.
+	Nacked    int // unprocessed jobs acknowledged with ErrDrained.
+	HandedOff int // unprocessed jobs passed to the drain hand-off func.
+}
+
 // Proc represents the processor to be applied on each Job by the worker.
 type Proc interface {
 	Exec(ctx context.Context, job Job) error